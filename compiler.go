@@ -0,0 +1,301 @@
+package json2json
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compiler builds an expression tree from tokens
+// with a recursive descent over the grammar:
+//
+//	expr    = unary { operator unary }
+//	unary   = ( "-" | "!" ) unary | primary
+//	primary = number | string | key | jsonpath | constant | param
+//	        | function "(" [ arg { "," arg } ] ")"
+//	        | "(" expr ")"
+//	arg     = expr | lambda
+//	lambda  = ( ident | "(" [ ident { "," ident } ] ")" ) "=>" expr
+//	param   = ident { "." field }
+//
+// binary operators are left associative
+// and bind by their precedence in opPrecedence
+// a lambda is only allowed as the second argument
+// of the functions in lambdaFunc
+type compiler struct {
+	tokens []token
+	i      int
+	params [][]string
+}
+
+// peek returns the current token
+func (c *compiler) peek() token {
+	return c.tokens[c.i]
+}
+
+// advance returns the current token and moves to the next one
+func (c *compiler) advance() token {
+	tok := c.tokens[c.i]
+	if tok.kind != tokenEOF {
+		c.i++
+	}
+	return tok
+}
+
+// expect advances over a token of the given kind
+func (c *compiler) expect(kind tokenKind, want string) (token, error) {
+	tok := c.advance()
+	if tok.kind != kind {
+		return tok, errorAt(tok.pos, "expected %s, got %s", want, tok)
+	}
+	return tok, nil
+}
+
+// expr parses binary operators
+// whose precedence is at least minPrecedence
+func (c *compiler) expr(minPrecedence int) (exprNode, error) {
+	x, err := c.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := c.peek()
+		if tok.kind != tokenOp {
+			return x, nil
+		}
+		op := Operator(tok.val)
+		precedence, ok := opPrecedence[op]
+		if !ok {
+			return nil, errorAt(tok.pos, "unexpected %s", tok)
+		}
+		if precedence < minPrecedence {
+			return x, nil
+		}
+		c.advance()
+		y, err := c.expr(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		x = &opNode{op: op, x: x, y: y, pos: tok.pos}
+	}
+}
+
+// unary parses an operand with a prefix operator
+// a negated number is folded into the number
+func (c *compiler) unary() (exprNode, error) {
+	tok := c.peek()
+	if tok.kind != tokenOp {
+		return c.primary()
+	}
+	op := Operator(tok.val)
+	if _, ok := unaryOpFunc[op]; !ok {
+		return nil, errorAt(tok.pos, "unexpected %s", tok)
+	}
+	c.advance()
+	if next := c.peek(); op == Sub && next.kind == tokenNumber {
+		// -9223372036854775808 is an int64 only once negated
+		if i, err := strconv.ParseInt(string(Sub)+next.val, 10, 64); err == nil {
+			c.advance()
+			return &literalNode{val: i}, nil
+		}
+	}
+	x, err := c.unary()
+	if err != nil {
+		return nil, err
+	}
+	if lit, ok := x.(*literalNode); ok && op == Sub {
+		switch val := lit.val.(type) {
+		case int64:
+			return &literalNode{val: -val}, nil
+		case float64:
+			return &literalNode{val: -val}, nil
+		}
+	}
+	return &unaryNode{op: op, x: x, pos: tok.pos}, nil
+}
+
+// primary parses an operand
+func (c *compiler) primary() (exprNode, error) {
+	tok := c.advance()
+	switch tok.kind {
+	case tokenNumber:
+		if strInt, err := strconv.ParseInt(tok.val, 10, 64); err == nil {
+			return &literalNode{val: strInt}, nil
+		}
+		strFloat, err := strconv.ParseFloat(tok.val, 64)
+		if err != nil {
+			return nil, errorAt(tok.pos, "invalid number %s", tok)
+		}
+		return &literalNode{val: strFloat}, nil
+	case tokenString:
+		return &literalNode{val: tok.val}, nil
+	case tokenKey:
+		anchor, str, err := parseAnchor(tok.val)
+		if err != nil {
+			return nil, errorAt(tok.pos, "%w", err)
+		}
+		var path []pathSegment
+		if anchor == anchorScope || str != "" {
+			if path, err = parsePath(str); err != nil {
+				return nil, errorAt(tok.pos, "%w", err)
+			}
+		}
+		return &keyNode{anchor: anchor, path: path, pos: tok.pos}, nil
+	case tokenJSONPath:
+		query, err := parseJSONPath(tok.val, tok.pos)
+		if err != nil {
+			return nil, err
+		}
+		return &jsonPathNode{query: query}, nil
+	case tokenIdent:
+		if c.peek().kind == tokenLeftBracket {
+			return c.call(tok)
+		}
+		if name, field, _ := strings.Cut(tok.val, string(Dot)); c.isParam(name) {
+			var path []pathSegment
+			if field != "" {
+				var err error
+				if path, err = parsePath(field); err != nil {
+					return nil, errorAt(tok.pos, "%w", err)
+				}
+			}
+			return &paramNode{name: name, path: path, pos: tok.pos}, nil
+		}
+		if constant, ok := constMap[Const(strings.ToUpper(tok.val))]; ok {
+			return &literalNode{val: constant}, nil
+		}
+		return nil, errorAt(tok.pos, "unknown string %s", tok)
+	case tokenLeftBracket:
+		x, err := c.expr(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = c.expect(tokenRightBracket, string(RightBracket)); err != nil {
+			return nil, err
+		}
+		return x, nil
+	default:
+		return nil, errorAt(tok.pos, "unexpected %s", tok)
+	}
+}
+
+// isParam checks if a name is a parameter
+// of a lambda that is being compiled
+func (c *compiler) isParam(name string) bool {
+	for _, params := range c.params {
+		for _, param := range params {
+			if param == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lambda parses a lambda with at most maxParams parameters
+// e.g. x => x.quantity or (acc, x) => acc + x.quantity
+func (c *compiler) lambda(maxParams int) (exprNode, error) {
+	start := c.peek()
+	var tokens []token
+	if start.kind == tokenLeftBracket {
+		c.advance()
+		for c.peek().kind != tokenRightBracket {
+			if len(tokens) > 0 {
+				if _, err := c.expect(tokenComma, string(Comma)); err != nil {
+					return nil, err
+				}
+			}
+			tok, err := c.expect(tokenIdent, "lambda parameter")
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+		}
+		c.advance()
+	} else {
+		tok, err := c.expect(tokenIdent, "lambda")
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, tok)
+	}
+	if _, err := c.expect(tokenArrow, string(Arrow)); err != nil {
+		return nil, err
+	}
+	if len(tokens) > maxParams {
+		return nil, errorAt(start.pos, "invalid number of lambda parameters: %d", len(tokens))
+	}
+	params := make([]string, len(tokens))
+	for i, tok := range tokens {
+		if strings.Contains(tok.val, string(Dot)) || isReserved(tok.val) {
+			return nil, errorAt(tok.pos, "invalid lambda parameter %s", tok)
+		}
+		for _, param := range params[:i] {
+			if param == tok.val {
+				return nil, errorAt(tok.pos, "duplicate lambda parameter %s", tok)
+			}
+		}
+		params[i] = tok.val
+	}
+	c.params = append(c.params, params)
+	body, err := c.expr(0)
+	c.params = c.params[:len(c.params)-1]
+	if err != nil {
+		return nil, err
+	}
+	return &lambdaNode{params: params, body: body}, nil
+}
+
+// isReserved checks if a name is a constant or a function name,
+// which cannot be a lambda parameter
+func isReserved(name string) bool {
+	if _, ok := constMap[Const(strings.ToUpper(name))]; ok {
+		return true
+	}
+	fn := Func(name)
+	_, ok := fnFunc[fn]
+	return ok || parserFunc[fn] != nil || lazyFunc[fn] != nil
+}
+
+// call parses the arguments of a function call
+// a string literal pattern of a regex function is compiled here
+// and so is the lambda of a higher-order function
+func (c *compiler) call(name token) (exprNode, error) {
+	fn := Func(name.val)
+	if _, ok := fnFunc[fn]; !ok && parserFunc[fn] == nil && lazyFunc[fn] == nil {
+		return nil, errorAt(name.pos, "unknown func %s", name)
+	}
+	c.advance()
+	args := make([]exprNode, 0)
+	if c.peek().kind == tokenRightBracket {
+		c.advance()
+		return &callNode{fn: fn, args: args, pos: name.pos}, nil
+	}
+	for {
+		pos := c.peek().pos
+		var arg exprNode
+		var err error
+		if maxParams, ok := lambdaFunc[fn]; ok && len(args) == 1 {
+			arg, err = c.lambda(maxParams)
+		} else {
+			arg, err = c.expr(0)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(args) == 1 && patternFunc[fn] {
+			if arg, err = compilePattern(arg, pos); err != nil {
+				return nil, err
+			}
+		}
+		args = append(args, arg)
+		tok := c.advance()
+		switch tok.kind {
+		case tokenComma:
+			continue
+		case tokenRightBracket:
+			return &callNode{fn: fn, args: args, pos: name.pos}, nil
+		default:
+			return nil, errorAt(tok.pos, "expected %s or %s, got %s", Comma, RightBracket, tok)
+		}
+	}
+}
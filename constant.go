@@ -9,11 +9,20 @@ const (
 	False      Const = "FALSE"
 	NoParam    Const = "NO_PARAM"
 	EmptyArray Const = "EMPTY_ARRAY"
+	Missing    Const = "MISSING"
 )
 
 // NoParamVar is a variable that represents no parameter
+// an output key that evaluates to NO_PARAM is omitted
+// while NIL is written as null
 var NoParamVar any = nil
 
+// MissingVar is a variable that represents a missing input key
+// an input key that is not found evaluates to MISSING
+// while a key with a null value evaluates to NIL
+// operators and most functions see MISSING as NIL
+var MissingVar any = nil
+
 // constMap is a map that contains all constants
 var constMap = map[Const]any{
 	Nil:        nil,
@@ -21,4 +30,25 @@ var constMap = map[Const]any{
 	False:      false,
 	NoParam:    &NoParamVar,
 	EmptyArray: []any{},
+	Missing:    &MissingVar,
+}
+
+// isNoParam checks if a value is the NO_PARAM constant
+func isNoParam(val any) bool {
+	ptr, ok := val.(*any)
+	return ok && ptr == &NoParamVar
+}
+
+// isMissing checks if a value is the MISSING constant
+func isMissing(val any) bool {
+	ptr, ok := val.(*any)
+	return ok && ptr == &MissingVar
+}
+
+// missingToNil returns nil if a value is the MISSING constant
+func missingToNil(val any) any {
+	if isMissing(val) {
+		return nil
+	}
+	return val
 }
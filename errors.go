@@ -0,0 +1,202 @@
+package json2json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Error is an error of parsing or evaluating an expression
+type Error struct {
+	// Key is the output key of the process spec
+	// the expression is written to
+	Key string
+	// Expr is the source of the expression
+	Expr string
+	// Offset is the byte offset of the failing token in Expr
+	Offset int
+	// Column is the column of the failing token in Expr, starting from 1
+	Column int
+	// FuncStack is the function call stack of the failing token
+	// from the outermost function
+	FuncStack []Func
+	// Err is the cause of the error
+	Err error
+}
+
+// errorAt creates an error at a byte offset of the expression
+func errorAt(offset int, format string, a ...any) *Error {
+	return &Error{
+		Offset: offset,
+		Err:    fmt.Errorf(format, a...),
+	}
+}
+
+// Error returns the error message
+// e.g. key data.tn: func STRING: invalid number of arguments: 0 at column 1
+func (e *Error) Error() string {
+	var b strings.Builder
+	if e.Key != "" {
+		b.WriteString("key ")
+		b.WriteString(e.Key)
+		b.WriteString(": ")
+	}
+	if len(e.FuncStack) > 0 {
+		fns := make([]string, len(e.FuncStack))
+		for i, fn := range e.FuncStack {
+			fns[i] = string(fn)
+		}
+		b.WriteString("func ")
+		b.WriteString(strings.Join(fns, " > "))
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+	if e.Expr != "" {
+		fmt.Fprintf(&b, " at column %d", e.Column)
+	}
+	return b.String()
+}
+
+// Unwrap returns the cause of the error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Caret returns the error message followed by the line of the expression
+// and a caret under the failing token
+func (e *Error) Caret() string {
+	if e.Expr == "" {
+		return e.Error()
+	}
+	start := strings.LastIndexByte(e.Expr[:e.Offset], '\n') + 1
+	end := strings.IndexByte(e.Expr[e.Offset:], '\n')
+	if end < 0 {
+		end = len(e.Expr)
+	} else {
+		end += e.Offset
+	}
+	var b strings.Builder
+	b.WriteString(e.Error())
+	b.WriteByte('\n')
+	b.WriteString(e.Expr[start:end])
+	b.WriteByte('\n')
+	for _, r := range e.Expr[start:e.Offset] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	return b.String()
+}
+
+// MarshalJSON encodes the error for API responses
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Key       string `json:"key,omitempty"`
+		Expr      string `json:"expr"`
+		Offset    int    `json:"offset"`
+		Column    int    `json:"column"`
+		FuncStack []Func `json:"func_stack,omitempty"`
+		Error     string `json:"error"`
+	}{
+		Key:       e.Key,
+		Expr:      e.Expr,
+		Offset:    e.Offset,
+		Column:    e.Column,
+		FuncStack: e.FuncStack,
+		Error:     e.Err.Error(),
+	})
+}
+
+// withExpr sets the expression of an error
+// and the column of its offset
+func withExpr(err error, str string) error {
+	var e *Error
+	if !errors.As(err, &e) || e.Expr != "" {
+		return err
+	}
+	withExpr := *e
+	withExpr.Expr = str
+	if withExpr.Offset > len(str) {
+		withExpr.Offset = len(str)
+	}
+	lineStart := strings.LastIndexByte(str[:withExpr.Offset], '\n') + 1
+	withExpr.Column = utf8.RuneCountInString(str[lineStart:withExpr.Offset]) + 1
+	return &withExpr
+}
+
+// withKey sets the output key of an error
+func withKey(err error, key string) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		return fmt.Errorf("key %s: %w", key, err)
+	}
+	withKey := *e
+	withKey.Key = key
+	return &withKey
+}
+
+// ErrorPolicy decides what happens when a key of a process spec fails
+type ErrorPolicy int
+
+const (
+	// FailFast stops at the first error and writes no output
+	FailFast ErrorPolicy = iota
+	// CollectAndFail evaluates every key
+	// and returns all errors without writing the output
+	CollectAndFail
+	// CollectAndContinue evaluates every key, omits the failing ones,
+	// writes the partial output and returns all errors
+	CollectAndContinue
+)
+
+// MultiError is a list of errors of the keys of a process spec
+// it can be inspected with errors.Is and errors.As like errors.Join
+type MultiError []error
+
+// Error returns the error messages separated by newlines
+func (m MultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Unwrap returns the errors
+func (m MultiError) Unwrap() []error {
+	return m
+}
+
+// OnError is what happens when a single key of a process spec fails
+type OnError string
+
+const (
+	// OnErrorDefault writes the value of a default expression
+	OnErrorDefault OnError = "default"
+	// OnErrorNull writes null
+	OnErrorNull OnError = "null"
+	// OnErrorOmit omits the key like NO_PARAM
+	OnErrorOmit OnError = "omit"
+	// OnErrorFail stops the evaluation and writes no output
+	// whatever the ErrorPolicy is
+	OnErrorFail OnError = "fail"
+)
+
+// KeyErrorPolicy is the error policy of a single key of a process spec
+// a key without its own policy follows the ErrorPolicy
+type KeyErrorPolicy struct {
+	OnError OnError
+	// Default is the expression written with OnErrorDefault
+	Default string
+}
+
+// keyPolicy is a KeyErrorPolicy with its default expression compiled
+type keyPolicy struct {
+	onError OnError
+	def     *Expr
+}
@@ -0,0 +1,315 @@
+package json2json
+
+import (
+	"errors"
+	"fmt"
+	"github.com/spf13/cast"
+)
+
+// Expr is a compiled expression
+// that can be evaluated many times
+type Expr struct {
+	str  string
+	root exprNode
+}
+
+// Compile compiles an expression
+// it returns an *Error if the expression is invalid
+func Compile(str string) (*Expr, error) {
+	tokens, err := lex(str)
+	if err != nil {
+		return nil, withExpr(err, str)
+	}
+	c := compiler{tokens: tokens}
+	root, err := c.expr(0)
+	if err != nil {
+		return nil, withExpr(err, str)
+	}
+	if tok := c.peek(); tok.kind != tokenEOF {
+		return nil, withExpr(errorAt(tok.pos, "unexpected %s", tok), str)
+	}
+	return &Expr{str: str, root: root}, nil
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.str
+}
+
+// Eval evaluates the expression against an input
+// it is safe to call concurrently
+// numbers formatted by FLOAT are returned as json.Number
+// it returns an *Error if the evaluation fails
+func (e *Expr) Eval(input map[string]any, opts ...ParserOpt) (any, error) {
+	return e.eval(NewParser(input, opts...))
+}
+
+// eval evaluates the expression with the state of a parser
+// a missing input key evaluates to nil
+func (e *Expr) eval(p *Parser) (any, error) {
+	res, err := e.root.eval(p)
+	if err != nil {
+		return nil, withExpr(err, e.str)
+	}
+	return missingToNil(res), nil
+}
+
+// exprNode is a node of a compiled expression
+type exprNode interface {
+	eval(p *Parser) (any, error)
+}
+
+// literalNode is a number, string or constant
+type literalNode struct {
+	val any
+}
+
+// eval returns the literal value
+func (n *literalNode) eval(*Parser) (any, error) {
+	return n.val, nil
+}
+
+// keyNode is an input key
+// e.g. [key1.key2.key3] or [@.sku]
+type keyNode struct {
+	anchor pathAnchor
+	path   []pathSegment
+	pos    int
+}
+
+// eval looks up the input key
+func (n *keyNode) eval(p *Parser) (any, error) {
+	val, err := p.parseInputByKey(n.anchor, n.path)
+	if err != nil {
+		return nil, p.evalError(n.pos, err)
+	}
+	return val, nil
+}
+
+// jsonPathNode is a JSONPath query of the input
+// e.g. $.packages[?@.quantity > 1].sku
+type jsonPathNode struct {
+	query *jsonPath
+}
+
+// eval runs the query from the root of the input
+func (n *jsonPathNode) eval(p *Parser) (any, error) {
+	return n.query.eval(p.input), nil
+}
+
+// paramNode is a parameter of a lambda
+// with the fields it looks up, e.g. x or x.item.weight
+type paramNode struct {
+	name string
+	path []pathSegment
+	pos  int
+}
+
+// eval looks up the fields of the argument bound to the parameter
+func (n *paramNode) eval(p *Parser) (any, error) {
+	val, err := p.lookupPath(p.param(n.name), n.path)
+	if err != nil {
+		return nil, p.evalError(n.pos, err)
+	}
+	return val, nil
+}
+
+// lambdaNode is a lambda with its parameters and its body
+// e.g. x => x.quantity * x.item_weight
+type lambdaNode struct {
+	params []string
+	body   exprNode
+}
+
+// eval returns the lambda itself
+// to be called by a higher-order function
+func (n *lambdaNode) eval(*Parser) (any, error) {
+	return n, nil
+}
+
+// opNode is an operator with its two operands
+type opNode struct {
+	op   Operator
+	x, y exprNode
+	pos  int
+}
+
+// eval evaluates both operands and applies the operator
+// && and || do not evaluate y if x decides the result
+// arithmetic operators compute exactly in decimal mode
+// a NaN or infinite result follows the NonFinite of the parser
+func (n *opNode) eval(p *Parser) (any, error) {
+	x, err := n.x.eval(p)
+	if err != nil {
+		return nil, err
+	}
+	x = missingToNil(x)
+	if n.op == LogicAnd || n.op == LogicOr {
+		b, err := cast.ToBoolE(unwrapNumber(x))
+		if err != nil {
+			return nil, p.evalError(n.pos, fmt.Errorf("operator %s: %w", n.op, err))
+		}
+		if b == (n.op == LogicOr) {
+			return b, nil
+		}
+	}
+	y, err := n.y.eval(p)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	if fn, ok := decimalOpFunc[n.op]; ok && p.decimal {
+		res, err = fn(x, missingToNil(y), p.scale)
+	} else {
+		res, err = opFunc[n.op](x, missingToNil(y))
+	}
+	if err == nil {
+		res, err = p.finite(res)
+	}
+	if err != nil {
+		return nil, p.evalError(n.pos, fmt.Errorf("operator %s: %w", n.op, err))
+	}
+	return res, nil
+}
+
+// unaryNode is a prefix operator with its operand
+type unaryNode struct {
+	op  Operator
+	x   exprNode
+	pos int
+}
+
+// eval evaluates the operand and applies the operator
+func (n *unaryNode) eval(p *Parser) (any, error) {
+	x, err := n.x.eval(p)
+	if err != nil {
+		return nil, err
+	}
+	var res any
+	if n.op == Sub && p.decimal {
+		res, err = decimalNegFunc(missingToNil(x), p.scale)
+	} else {
+		res, err = unaryOpFunc[n.op](missingToNil(x))
+	}
+	if err == nil {
+		res, err = p.finite(res)
+	}
+	if err != nil {
+		return nil, p.evalError(n.pos, fmt.Errorf("operator %s: %w", n.op, err))
+	}
+	return res, nil
+}
+
+// callNode is a function call with its arguments
+type callNode struct {
+	fn   Func
+	args []exprNode
+	pos  int
+}
+
+// eval evaluates the arguments and calls the function
+// only the functions in missingFunc see MISSING arguments,
+// the other functions see them as nil
+// to the functions in missingFunc, an input key
+// with an out of range index is MISSING too
+// the functions in lazyFunc evaluate their arguments themselves
+func (n *callNode) eval(p *Parser) (any, error) {
+	p.funcStack = append(p.funcStack, n.fn)
+	defer func() {
+		p.funcStack = p.funcStack[:len(p.funcStack)-1]
+	}()
+	if fn, ok := lazyFunc[n.fn]; ok {
+		return n.evalLazy(p, fn)
+	}
+	args := make([]any, 0, len(n.args))
+	for _, a := range n.args {
+		arg, err := a.eval(p)
+		if err != nil {
+			if !missingFunc[n.fn] || !isOutOfRange(a, err) {
+				return nil, err
+			}
+			arg = constMap[Missing]
+		}
+		if !missingFunc[n.fn] {
+			arg = missingToNil(arg)
+		}
+		args = append(args, arg)
+	}
+	if n.fn == Var {
+		args = p.resolveVar(args)
+	}
+	var res any
+	var err error
+	if fn, ok := parserFunc[n.fn]; ok {
+		res, err = fn(p, args)
+	} else {
+		res, err = fnFunc[n.fn](args)
+	}
+	if err == nil {
+		res, err = p.finite(res)
+	}
+	if e, ok := err.(*Error); ok {
+		// the error of a lambda body has its own position
+		return nil, e
+	}
+	if err != nil {
+		return nil, p.evalError(n.pos, err)
+	}
+	return res, nil
+}
+
+// isOutOfRange checks if the error of an argument
+// is an out of range index of an input key or a lambda parameter,
+// not of an expression around it
+func isOutOfRange(a exprNode, err error) bool {
+	switch a.(type) {
+	case *keyNode, *paramNode:
+		var e *outOfRangeError
+		return errors.As(err, &e)
+	default:
+		return false
+	}
+}
+
+// evalLazy calls a lazy function
+// with arguments that are evaluated when it needs them
+func (n *callNode) evalLazy(p *Parser, fn func([]lazyArg) (any, error)) (any, error) {
+	args := make([]lazyArg, len(n.args))
+	for i, a := range n.args {
+		a := a
+		args[i] = func() (any, error) {
+			arg, err := a.eval(p)
+			return missingToNil(arg), err
+		}
+	}
+	res, err := fn(args)
+	if err == nil {
+		res, err = p.finite(res)
+	}
+	if e, ok := err.(*Error); ok {
+		// the error of an argument has its own position
+		return nil, e
+	}
+	if err != nil {
+		return nil, p.evalError(n.pos, err)
+	}
+	return res, nil
+}
+
+// walk calls fn for every node of an expression tree
+func walk(n exprNode, fn func(exprNode)) {
+	fn(n)
+	switch n := n.(type) {
+	case *opNode:
+		walk(n.x, fn)
+		walk(n.y, fn)
+	case *unaryNode:
+		walk(n.x, fn)
+	case *callNode:
+		for _, a := range n.args {
+			walk(a, fn)
+		}
+	case *lambdaNode:
+		walk(n.body, fn)
+	}
+}
@@ -1,11 +1,11 @@
 package json2json
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/spf13/cast"
 	"golang.org/x/exp/utf8string"
 	"math"
-	"reflect"
 	"unicode/utf8"
 )
 
@@ -31,6 +31,61 @@ const (
 	Gt       Func = "GT"
 	Lte      Func = "LTE"
 	Lt       Func = "LT"
+	Exists   Func = "EXISTS"
+	IsNull   Func = "IS_NULL"
+	Coalesce Func = "COALESCE"
+	Index    Func = "INDEX"
+	SafeDiv  Func = "SAFE_DIV"
+
+	Upper      Func = "UPPER"
+	Lower      Func = "LOWER"
+	Trim       Func = "TRIM"
+	TrimLeft   Func = "TRIM_LEFT"
+	TrimRight  Func = "TRIM_RIGHT"
+	Replace    Func = "REPLACE"
+	Split      Func = "SPLIT"
+	Join       Func = "JOIN"
+	Concat     Func = "CONCAT"
+	PadLeft    Func = "PAD_LEFT"
+	PadRight   Func = "PAD_RIGHT"
+	Contains   Func = "CONTAINS"
+	StartsWith Func = "STARTS_WITH"
+	EndsWith   Func = "ENDS_WITH"
+	IndexOf    Func = "INDEX_OF"
+	Repeat     Func = "REPEAT"
+
+	RegexMatch      Func = "REGEX_MATCH"
+	RegexExtract    Func = "REGEX_EXTRACT"
+	RegexExtractAll Func = "REGEX_EXTRACT_ALL"
+	RegexGroups     Func = "REGEX_GROUPS"
+	RegexReplace    Func = "REGEX_REPLACE"
+
+	Now          Func = "NOW"
+	ParseTime    Func = "PARSE_TIME"
+	FormatTime   Func = "FORMAT_TIME"
+	ToZone       Func = "TO_ZONE"
+	AddTime      Func = "ADD_TIME"
+	SubTime      Func = "SUB_TIME"
+	TruncateTime Func = "TRUNCATE_TIME"
+	DiffTime     Func = "DIFF_TIME"
+
+	Round Func = "ROUND"
+	Floor Func = "FLOOR"
+	Ceil  Func = "CEIL"
+	Abs   Func = "ABS"
+	Min   Func = "MIN"
+	Max   Func = "MAX"
+	Clamp Func = "CLAMP"
+	Pow   Func = "POW"
+	Sqrt  Func = "SQRT"
+	Mod   Func = "MOD"
+
+	Map    Func = "MAP"
+	Filter Func = "FILTER"
+	Reduce Func = "REDUCE"
+	Find   Func = "FIND"
+	Any    Func = "ANY"
+	All    Func = "ALL"
 )
 
 // funcMap is a map that contains all functions
@@ -45,14 +100,101 @@ var fnFunc = map[Func]func([]any) (any, error){
 	Set:      setFunc,
 	Len:      lenFunc,
 	SliceStr: sliceStrFunc,
-	If:       ifFunc,
-	Switch:   switchFunc,
-	And:      andFunc,
-	Or:       orFunc,
 	Gte:      gteFunc,
 	Gt:       gtFunc,
 	Lte:      lteFunc,
 	Lt:       ltFunc,
+	Exists:   existsFunc,
+	IsNull:   isNullFunc,
+	Coalesce: coalesceFunc,
+
+	Upper:      upperFunc,
+	Lower:      lowerFunc,
+	Trim:       trimFunc,
+	TrimLeft:   trimLeftFunc,
+	TrimRight:  trimRightFunc,
+	Replace:    replaceFunc,
+	Split:      splitFunc,
+	Join:       joinFunc,
+	Concat:     concatFunc,
+	PadLeft:    padLeftFunc,
+	PadRight:   padRightFunc,
+	Contains:   containsFunc,
+	StartsWith: startsWithFunc,
+	EndsWith:   endsWithFunc,
+	IndexOf:    indexOfFunc,
+	Repeat:     repeatFunc,
+
+	RegexMatch:      regexMatchFunc,
+	RegexExtract:    regexExtractFunc,
+	RegexExtractAll: regexExtractAllFunc,
+	RegexGroups:     regexGroupsFunc,
+	RegexReplace:    regexReplaceFunc,
+
+	ParseTime:    parseTimeFunc,
+	FormatTime:   formatTimeFunc,
+	ToZone:       toZoneFunc,
+	AddTime:      addTimeFunc,
+	SubTime:      subTimeFunc,
+	TruncateTime: truncateTimeFunc,
+	DiffTime:     diffTimeFunc,
+
+	Round: roundFunc,
+	Floor: floorFunc,
+	Ceil:  ceilFunc,
+	Abs:   absFunc,
+	Min:   minFunc,
+	Max:   maxFunc,
+	Clamp: clampFunc,
+	Pow:   powFunc,
+	Sqrt:  sqrtFunc,
+	Mod:   modFunc,
+}
+
+// lazyFunc is a map that contains the functions
+// that evaluate an argument only when they need it,
+// so IF([z]=0, 0, 1/[z]) does not divide by zero
+var lazyFunc = map[Func]func([]lazyArg) (any, error){
+	If:     ifFunc,
+	Switch: switchFunc,
+	And:    andFunc,
+	Or:     orFunc,
+}
+
+// lazyArg evaluates an argument of a lazy function
+type lazyArg func() (any, error)
+
+// lazyValues wraps values that are already evaluated as lazy arguments
+func lazyValues(vals ...any) []lazyArg {
+	args := make([]lazyArg, len(vals))
+	for i, val := range vals {
+		val := val
+		args[i] = func() (any, error) { return val, nil }
+	}
+	return args
+}
+
+// parserFunc is a map that contains the functions
+// that need the state of the parser
+var parserFunc = map[Func]func(*Parser, []any) (any, error){
+	Index:   indexFunc,
+	SafeDiv: safeDivFunc,
+	Now:     nowFunc,
+
+	Map:    mapFunc,
+	Filter: filterFunc,
+	Reduce: reduceFunc,
+	Find:   findFunc,
+	Any:    anyFunc,
+	All:    allFunc,
+}
+
+// missingFunc is the set of functions
+// that tell a missing input key from a null one
+var missingFunc = map[Func]bool{
+	Exists:   true,
+	IsNull:   true,
+	Coalesce: true,
 }
 
 // stringFunc is the string function
@@ -62,7 +204,7 @@ func stringFunc(args []any) (any, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	return cast.ToStringE(args[0])
+	return toStringE(args[0])
 }
 
 // intFunc is the int function
@@ -72,7 +214,7 @@ func intFunc(args []any) (any, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	return cast.ToInt64E(args[0])
+	return cast.ToInt64E(unwrapNumber(args[0]))
 }
 
 // floatFunc is the float function
@@ -80,24 +222,27 @@ func intFunc(args []any) (any, error) {
 // convert expr to float
 // precision is the number of digits after the decimal point
 // default precision is 2
+// expr is rounded half away from zero in its decimal form,
+// so FLOAT(1.005, 2) is 1.01
+// the result keeps its trailing zeros when written, e.g. 2.0
 func floatFunc(args []any) (any, error) {
 	switch len(args) {
 	case 1, 2:
-		floatNum, err := cast.ToFloat64E(args[0])
+		num, err := toRat(args[0])
 		if err != nil {
 			return nil, err
 		}
-		precision := 2.0
+		precision := uint(2)
 		if len(args) == 2 {
-			uintPrecision := uint(2)
-			uintPrecision, err = cast.ToUintE(args[1])
+			precision, err = cast.ToUintE(unwrapNumber(args[1]))
 			if err != nil {
 				return nil, err
 			}
-			precision, _ = cast.ToFloat64E(uintPrecision)
+			if precision > maxPrecision {
+				return nil, fmt.Errorf("precision too large: %d", precision)
+			}
 		}
-		precisionPow := math.Pow(10, precision)
-		return math.Round(floatNum*precisionPow) / precisionPow, nil
+		return json.Number(num.FloatString(int(precision))), nil
 	default:
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
@@ -110,7 +255,7 @@ func boolFunc(args []any) (any, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	return cast.ToBoolE(args[0])
+	return cast.ToBoolE(unwrapNumber(args[0]))
 }
 
 // objectFunc is the object function
@@ -160,7 +305,8 @@ func setFunc(args []any) (any, error) {
 
 // varFunc is the var function
 // VAR(expr, default)
-// if expr is nil, return default, else return expr
+// if expr names a SET variable of the process spec, expr is its value
+// if expr is nil or MISSING, return default, else return expr
 func varFunc(args []any) (any, error) {
 	if len(args) != 2 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
@@ -201,12 +347,12 @@ func sliceStrFunc(args []any) (anyStr any, err error) {
 	if len(args) != 3 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	str, _ := cast.ToStringE(args[0])
-	start, err := cast.ToIntE(args[1])
+	str, _ := toStringE(args[0])
+	start, err := cast.ToIntE(unwrapNumber(args[1]))
 	if err != nil {
 		return
 	}
-	end, err := cast.ToIntE(args[2])
+	end, err := cast.ToIntE(unwrapNumber(args[2]))
 	if err != nil {
 		return
 	}
@@ -222,18 +368,23 @@ func sliceStrFunc(args []any) (anyStr any, err error) {
 // ifFunc is the if function
 // IF(expr, x, y)
 // if expr is true, return x, else return y
-func ifFunc(args []any) (any, error) {
+// only the chosen branch is evaluated
+func ifFunc(args []lazyArg) (any, error) {
 	if len(args) != 3 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	expr, err := cast.ToBoolE(args[0])
+	cond, err := args[0]()
+	if err != nil {
+		return nil, err
+	}
+	expr, err := cast.ToBoolE(unwrapNumber(cond))
 	if err != nil {
 		return nil, err
 	}
 	if expr {
-		return args[1], nil
+		return args[1]()
 	}
-	return args[2], nil
+	return args[2]()
 }
 
 // switchFunc is the switch function
@@ -243,7 +394,10 @@ func ifFunc(args []any) (any, error) {
 // ...
 // if expr == xn, return yn
 // else return default
-func switchFunc(args []any) (any, error) {
+// expr is compared to the xs like =, so 1 matches the input number 1
+// the xs are evaluated in order until one matches
+// and only the chosen y or default is evaluated
+func switchFunc(args []lazyArg) (any, error) {
 	if (len(args) % 2) != 0 {
 		return nil, fmt.Errorf("invalid odd number of arguments: %d", len(args))
 	}
@@ -251,28 +405,38 @@ func switchFunc(args []any) (any, error) {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
 	if len(args) == 2 {
-		return args[1], nil
+		return args[1]()
 	}
-	expr := args[0]
-	for i := 1; i < len(args); i += 2 {
-		if reflect.TypeOf(expr) == reflect.TypeOf(args[i]) {
-			if reflect.DeepEqual(expr, args[i]) {
-				return args[i+1], nil
-			}
+	expr, err := args[0]()
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args)-1; i += 2 {
+		x, err := args[i]()
+		if err != nil {
+			return nil, err
+		}
+		if equal(expr, x) {
+			return args[i+1]()
 		}
 	}
-	return args[len(args)-1], nil
+	return args[len(args)-1]()
 }
 
 // andFunc is the and function
 // AND(expr1, expr2, ..., exprn)
 // if all expr are true, return true, else return false
-func andFunc(args []any) (any, error) {
+// the exprs after the first false one are not evaluated
+func andFunc(args []lazyArg) (any, error) {
 	if len(args) == 0 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
 	for _, arg := range args {
-		if expr, err := cast.ToBoolE(arg); err != nil {
+		val, err := arg()
+		if err != nil {
+			return false, err
+		}
+		if expr, err := cast.ToBoolE(unwrapNumber(val)); err != nil {
 			return false, err
 		} else if !expr {
 			return false, nil
@@ -284,12 +448,17 @@ func andFunc(args []any) (any, error) {
 // orFunc is the or function
 // OR(expr1, expr2, ..., exprn)
 // if any expr is true, return true, else return false
-func orFunc(args []any) (any, error) {
+// the exprs after the first true one are not evaluated
+func orFunc(args []lazyArg) (any, error) {
 	if len(args) == 0 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
 	for _, arg := range args {
-		if expr, err := cast.ToBoolE(arg); err != nil {
+		val, err := arg()
+		if err != nil {
+			return false, err
+		}
+		if expr, err := cast.ToBoolE(unwrapNumber(val)); err != nil {
 			return false, err
 		} else if expr {
 			return true, nil
@@ -298,74 +467,141 @@ func orFunc(args []any) (any, error) {
 	return false, nil
 }
 
-// gteFunc is the greater than or equal function
-// GTE(expr1, expr2)
-// if expr1 >= expr2, return true, else return false
-func gteFunc(args []any) (any, error) {
+// compare compares two numbers and returns cmp of the result,
+// which is -1 if expr1 < expr2, 0 if expr1 == expr2 and 1 if expr1 > expr2
+// integers are compared as int64 and other numbers as exact rationals,
+// so numbers above 2^53 keep their precision
+// a NaN or infinite float is compared as a float, NaN is never true
+func compare(args []any, cmp func(int) bool) (any, error) {
 	if len(args) != 2 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	first, err := cast.ToFloat64E(args[0])
-	if err != nil {
-		return nil, err
+	if first, ok := toInt64(args[0]); ok {
+		if second, ok := toInt64(args[1]); ok {
+			switch {
+			case first < second:
+				return cmp(-1), nil
+			case first > second:
+				return cmp(1), nil
+			default:
+				return cmp(0), nil
+			}
+		}
+	}
+	first, firstErr := toRat(args[0])
+	second, secondErr := toRat(args[1])
+	if firstErr == nil && secondErr == nil {
+		return cmp(first.Cmp(second)), nil
 	}
-	second, err := cast.ToFloat64E(args[1])
+	x, y, err := toFloat64s(args[0], args[1])
 	if err != nil {
 		return nil, err
 	}
-	return first >= second, nil
+	switch {
+	case math.IsNaN(x) || math.IsNaN(y):
+		return false, nil
+	case x < y:
+		return cmp(-1), nil
+	case x > y:
+		return cmp(1), nil
+	default:
+		return cmp(0), nil
+	}
+}
+
+// gteFunc is the greater than or equal function
+// GTE(expr1, expr2)
+// if expr1 >= expr2, return true, else return false
+func gteFunc(args []any) (any, error) {
+	return compare(args, func(c int) bool { return c >= 0 })
 }
 
 // gtFunc is the greater than function
 // GT(expr1, expr2)
 // if expr1 > expr2, return true, else return false
 func gtFunc(args []any) (any, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
-	}
-	first, err := cast.ToFloat64E(args[0])
-	if err != nil {
-		return nil, err
-	}
-	second, err := cast.ToFloat64E(args[1])
-	if err != nil {
-		return nil, err
-	}
-	return first > second, nil
+	return compare(args, func(c int) bool { return c > 0 })
 }
 
 // lteFunc is the less than or equal function
 // LTE(expr1, expr2)
 // if expr1 <= expr2, return true, else return false
 func lteFunc(args []any) (any, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
-	}
-	first, err := cast.ToFloat64E(args[0])
-	if err != nil {
-		return nil, err
-	}
-	second, err := cast.ToFloat64E(args[1])
-	if err != nil {
-		return nil, err
-	}
-	return first <= second, nil
+	return compare(args, func(c int) bool { return c <= 0 })
 }
 
 // ltFunc is the less than function
 // LT(expr1, expr2)
 // if expr1 < expr2, return true, else return false
 func ltFunc(args []any) (any, error) {
-	if len(args) != 2 {
+	return compare(args, func(c int) bool { return c < 0 })
+}
+
+// existsFunc is the exists function
+// EXISTS(expr)
+// if expr is MISSING, return false, else return true
+// a key with a null value exists
+func existsFunc(args []any) (any, error) {
+	if len(args) != 1 {
 		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	first, err := cast.ToFloat64E(args[0])
-	if err != nil {
-		return nil, err
+	return !isMissing(args[0]), nil
+}
+
+// isNullFunc is the is null function
+// IS_NULL(expr)
+// if expr is null, return true, else return false
+// a missing key is not null
+func isNullFunc(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
 	}
-	second, err := cast.ToFloat64E(args[1])
+	return args[0] == nil, nil
+}
+
+// coalesceFunc is the coalesce function
+// COALESCE(expr1, expr2, ...)
+// return the first expr that is neither MISSING nor null
+// if there is none, return null
+func coalesceFunc(args []any) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	for _, arg := range args {
+		if arg != nil && !isMissing(arg) {
+			return arg, nil
+		}
+	}
+	return nil, nil
+}
+
+// indexFunc is the index function
+// INDEX()
+// return the position of the current element of an ARRAY,
+// starting from 0
+func indexFunc(p *Parser, args []any) (any, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	index, err := p.index()
 	if err != nil {
 		return nil, err
 	}
-	return first < second, nil
+	return int64(index), nil
+}
+
+// safeDivFunc is the safe division function
+// SAFE_DIV(expr1, expr2, default)
+// if expr2 is zero, return default, else return expr1 / expr2
+func safeDivFunc(p *Parser, args []any) (any, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	if isZero(args[1]) {
+		return args[2], nil
+	}
+	if p.decimal {
+		return decimalDivFunc(args[0], args[1], p.scale)
+	}
+	return divFunc(args[0], args[1])
 }
@@ -0,0 +1,162 @@
+package json2json
+
+import (
+	"fmt"
+	"github.com/spf13/cast"
+)
+
+// lambdaFunc is a map that contains the higher-order functions
+// whose second argument is a lambda
+// and the maximum number of parameters of the lambda
+var lambdaFunc = map[Func]int{
+	Map:    2,
+	Filter: 2,
+	Reduce: 3,
+	Find:   2,
+	Any:    2,
+	All:    2,
+}
+
+// lambdaArgs converts the array of a higher-order function
+// a null array has no elements
+func lambdaArgs(args []any, n int) ([]any, error) {
+	if len(args) != n {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	elems, ok := toSlice(args[0])
+	if !ok {
+		return nil, fmt.Errorf("invalid type: %T", args[0])
+	}
+	return elems, nil
+}
+
+// predicate calls a lambda with an element and its index
+// and converts the result to bool
+func (p *Parser) predicate(fn any, elem any, i int) (bool, error) {
+	res, err := p.callLambda(fn, elem, int64(i))
+	if err != nil {
+		return false, err
+	}
+	return cast.ToBoolE(unwrapNumber(res))
+}
+
+// mapFunc is the map function
+// MAP(arr, x => expr) or MAP(arr, (x, i) => expr)
+// return the array of expr evaluated for every element x
+// at index i of arr
+func mapFunc(p *Parser, args []any) (any, error) {
+	elems, err := lambdaArgs(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	arr := make([]any, len(elems))
+	for i, elem := range elems {
+		if arr[i], err = p.callLambda(args[1], elem, int64(i)); err != nil {
+			return nil, err
+		}
+	}
+	return arr, nil
+}
+
+// filterFunc is the filter function
+// FILTER(arr, x => expr) or FILTER(arr, (x, i) => expr)
+// return the array of the elements x of arr
+// at index i for which expr is true
+func filterFunc(p *Parser, args []any) (any, error) {
+	elems, err := lambdaArgs(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	arr := make([]any, 0, len(elems))
+	for i, elem := range elems {
+		ok, err := p.predicate(args[1], elem, i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			arr = append(arr, elem)
+		}
+	}
+	return arr, nil
+}
+
+// reduceFunc is the reduce function
+// REDUCE(arr, (acc, x) => expr, init) or REDUCE(arr, (acc, x, i) => expr, init)
+// return the last value of acc, which starts as init
+// and is set to expr for every element x at index i of arr
+func reduceFunc(p *Parser, args []any) (any, error) {
+	elems, err := lambdaArgs(args, 3)
+	if err != nil {
+		return nil, err
+	}
+	acc := args[2]
+	for i, elem := range elems {
+		if acc, err = p.callLambda(args[1], acc, elem, int64(i)); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// findFunc is the find function
+// FIND(arr, x => expr) or FIND(arr, (x, i) => expr)
+// return the first element x of arr at index i for which expr is true,
+// or nil if there is none
+func findFunc(p *Parser, args []any) (any, error) {
+	elems, err := lambdaArgs(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	for i, elem := range elems {
+		ok, err := p.predicate(args[1], elem, i)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return elem, nil
+		}
+	}
+	return nil, nil
+}
+
+// anyFunc is the any function
+// ANY(arr, x => expr) or ANY(arr, (x, i) => expr)
+// if expr is true for an element x of arr at index i, return true,
+// else return false
+func anyFunc(p *Parser, args []any) (any, error) {
+	return some(p, args, true)
+}
+
+// allFunc is the all function
+// ALL(arr, x => expr) or ALL(arr, (x, i) => expr)
+// if expr is true for every element x of arr at index i, return true,
+// else return false, an empty arr gives true
+func allFunc(p *Parser, args []any) (any, error) {
+	found, err := some(p, args, false)
+	if err != nil {
+		return nil, err
+	}
+	return !found, nil
+}
+
+// some checks if the lambda of a higher-order function
+// gives want for an element, it stops at the first one
+func some(p *Parser, args []any, want bool) (bool, error) {
+	elems, err := lambdaArgs(args, 2)
+	if err != nil {
+		return false, err
+	}
+	for i, elem := range elems {
+		ok, err := p.predicate(args[1], elem, i)
+		if err != nil {
+			return false, err
+		}
+		if ok == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,317 @@
+package json2json
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cast"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// maxPrecision is the maximum number of digits
+// FLOAT, ROUND, FLOOR and CEIL round to, before or after the decimal point,
+// so that a precision read from the input cannot hang the cpu,
+// it covers every float64
+const maxPrecision = 340
+
+// roundingMode decides if a number cut to a precision
+// is rounded away from zero, given the sign of the number,
+// whether the cut digits are below, at or above half
+// and whether the kept last digit is odd
+type roundingMode func(sign, half int, odd bool) bool
+
+// roundingModes is a map that contains the rounding modes of ROUND
+var roundingModes = map[string]roundingMode{
+	"HALF_UP":   func(sign, half int, odd bool) bool { return half >= 0 },
+	"HALF_EVEN": func(sign, half int, odd bool) bool { return half > 0 || half == 0 && odd },
+	"UP":        func(sign, half int, odd bool) bool { return true },
+	"DOWN":      func(sign, half int, odd bool) bool { return false },
+	"CEILING":   func(sign, half int, odd bool) bool { return sign > 0 },
+	"FLOOR":     func(sign, half int, odd bool) bool { return sign < 0 },
+}
+
+// roundRat rounds a rational to precision digits after the decimal point
+// a negative precision rounds to tens, hundreds and so on
+func roundRat(r *big.Rat, precision int, mode roundingMode) *big.Rat {
+	exp := precision
+	if exp < 0 {
+		exp = -exp
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+	v := new(big.Rat).Set(r)
+	if precision >= 0 {
+		v.Mul(v, new(big.Rat).SetInt(scale))
+	} else {
+		v.Quo(v, new(big.Rat).SetInt(scale))
+	}
+	q, rem := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		half := new(big.Int).Abs(rem)
+		half.Lsh(half, 1)
+		if mode(r.Sign(), half.Cmp(v.Denom()), q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(int64(r.Sign())))
+		}
+	}
+	if precision >= 0 {
+		return new(big.Rat).SetFrac(q, scale)
+	}
+	return new(big.Rat).SetInt(q.Mul(q, scale))
+}
+
+// round rounds the first argument to the precision of the second argument
+// with a rounding mode, default precision is 0
+func round(args []any, mode roundingMode) (any, error) {
+	num, err := toRat(args[0])
+	if err != nil {
+		return nil, err
+	}
+	precision := 0
+	if len(args) > 1 {
+		if precision, err = cast.ToIntE(unwrapNumber(args[1])); err != nil {
+			return nil, err
+		}
+	}
+	if precision > maxPrecision || precision < -maxPrecision {
+		return nil, fmt.Errorf("precision too large: %d", precision)
+	}
+	scale := precision
+	if scale < 0 {
+		scale = 0
+	}
+	return ratToNumber(roundRat(num, precision, mode), scale), nil
+}
+
+// roundFunc is the round function
+// ROUND(expr, precision, mode)
+// return expr rounded to precision digits after the decimal point
+// a negative precision rounds to tens, hundreds and so on
+// mode is HALF_UP, HALF_EVEN, UP, DOWN, CEILING or FLOOR
+// default precision is 0 and default mode is HALF_UP,
+// which rounds half away from zero like FLOAT
+func roundFunc(args []any) (any, error) {
+	if len(args) < 1 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	mode := roundingModes["HALF_UP"]
+	if len(args) == 3 {
+		name, err := toStringE(args[2])
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if mode, ok = roundingModes[strings.ToUpper(name)]; !ok {
+			return nil, fmt.Errorf("invalid rounding mode: %s", name)
+		}
+	}
+	return round(args, mode)
+}
+
+// floorFunc is the floor function
+// FLOOR(expr, precision)
+// return expr rounded toward negative infinity
+// to precision digits after the decimal point
+// default precision is 0
+func floorFunc(args []any) (any, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	return round(args, roundingModes["FLOOR"])
+}
+
+// ceilFunc is the ceil function
+// CEIL(expr, precision)
+// return expr rounded toward positive infinity
+// to precision digits after the decimal point
+// default precision is 0
+func ceilFunc(args []any) (any, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	return round(args, roundingModes["CEILING"])
+}
+
+// absFunc is the abs function
+// ABS(expr)
+// return the absolute value of expr
+// an integer gives an integer, anything else gives a float
+func absFunc(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	if i, ok := toInt64(args[0]); ok {
+		if i < 0 {
+			return negInt64(i)
+		}
+		return i, nil
+	}
+	if num, ok := args[0].(json.Number); ok {
+		return json.Number(strings.TrimPrefix(string(num), "-")), nil
+	}
+	num, err := cast.ToFloat64E(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return math.Abs(num), nil
+}
+
+// extreme returns the argument that compares first with cmp
+// a single array argument is the list of arguments
+// null arguments are skipped, if all of them are null, return nil
+func extreme(args []any, cmp int) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	if len(args) == 1 {
+		if elems, ok := toSlice(args[0]); ok {
+			args = elems
+		}
+	}
+	var res any
+	var resRat *big.Rat
+	for _, arg := range args {
+		if arg == nil {
+			continue
+		}
+		r, err := toRat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if resRat == nil || r.Cmp(resRat) == cmp {
+			res, resRat = arg, r
+		}
+	}
+	return res, nil
+}
+
+// minFunc is the min function
+// MIN(expr1, expr2, ...) or MIN(arr)
+// return the smallest number, null numbers are skipped
+func minFunc(args []any) (any, error) {
+	return extreme(args, -1)
+}
+
+// maxFunc is the max function
+// MAX(expr1, expr2, ...) or MAX(arr)
+// return the largest number, null numbers are skipped
+func maxFunc(args []any) (any, error) {
+	return extreme(args, 1)
+}
+
+// clampFunc is the clamp function
+// CLAMP(expr, min, max)
+// return min if expr is less than min, max if expr is greater than max,
+// else return expr
+func clampFunc(args []any) (any, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	rats := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		r, err := toRat(arg)
+		if err != nil {
+			return nil, err
+		}
+		rats[i] = r
+	}
+	if rats[1].Cmp(rats[2]) > 0 {
+		return nil, fmt.Errorf("invalid range: %v > %v", args[1], args[2])
+	}
+	if rats[0].Cmp(rats[1]) < 0 {
+		return args[1], nil
+	}
+	if rats[0].Cmp(rats[2]) > 0 {
+		return args[2], nil
+	}
+	return args[0], nil
+}
+
+// powFunc is the pow function
+// POW(base, exponent)
+// return base raised to exponent
+// an integer base and a non-negative integer exponent give an integer,
+// anything else gives a float
+func powFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	if base, ok := toInt64(args[0]); ok {
+		if exp, ok := toInt64(args[1]); ok && exp >= 0 {
+			return powInt64(base, exp)
+		}
+	}
+	base, err := cast.ToFloat64E(args[0])
+	if err != nil {
+		return nil, err
+	}
+	exp, err := cast.ToFloat64E(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return math.Pow(base, exp), nil
+}
+
+// powInt64 raises an integer to a non-negative integer
+// by repeated squaring
+func powInt64(base, exp int64) (int64, error) {
+	res := int64(1)
+	for {
+		var err error
+		if exp&1 == 1 {
+			if res, err = mulInt64(res, base); err != nil {
+				return 0, err
+			}
+		}
+		if exp >>= 1; exp == 0 {
+			return res, nil
+		}
+		if base, err = mulInt64(base, base); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// sqrtFunc is the sqrt function
+// SQRT(expr)
+// return the square root of expr as a float
+// the square root of a negative number is NaN
+func sqrtFunc(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	num, err := cast.ToFloat64E(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return math.Sqrt(num), nil
+}
+
+// modFunc is the mod function
+// MOD(expr1, expr2)
+// return the remainder of the division of expr1 by expr2
+// with the sign of expr2, so MOD(-1, 3) is 2 while -1 % 3 is -1
+// two integers give an integer, anything else gives a float
+func modFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	if isZero(args[1]) {
+		return nil, errDivByZero
+	}
+	return arith(args[0], args[1], func(a, b int64) (int64, error) {
+		if b == -1 {
+			return 0, nil
+		}
+		m := a % b
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m, nil
+	}, func(a, b float64) float64 {
+		m := math.Mod(a, b)
+		if m != 0 && (m < 0) != (b < 0) {
+			m += b
+		}
+		return m
+	})
+}
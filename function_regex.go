@@ -0,0 +1,204 @@
+package json2json
+
+import (
+	"fmt"
+	"github.com/spf13/cast"
+	"regexp"
+)
+
+// patternFunc is the set of functions
+// whose second argument is a regular expression
+var patternFunc = map[Func]bool{
+	RegexMatch:      true,
+	RegexExtract:    true,
+	RegexExtractAll: true,
+	RegexGroups:     true,
+	RegexReplace:    true,
+}
+
+// compilePattern compiles a regular expression written as a string literal
+// so that it is compiled once with the expression
+// instead of on every evaluation
+func compilePattern(arg exprNode, pos int) (exprNode, error) {
+	lit, ok := arg.(*literalNode)
+	if !ok {
+		return arg, nil
+	}
+	pattern, ok := lit.val.(string)
+	if !ok {
+		return arg, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errorAt(pos, "invalid pattern: %w", err)
+	}
+	return &literalNode{val: re}, nil
+}
+
+// toRegexp returns a compiled regular expression
+// or compiles a pattern with RE2 syntax
+func toRegexp(arg any) (*regexp.Regexp, error) {
+	if re, ok := arg.(*regexp.Regexp); ok {
+		return re, nil
+	}
+	pattern, err := toStringE(arg)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	return re, nil
+}
+
+// regexArgs converts the string and the pattern of a regex function
+func regexArgs(args []any) (string, *regexp.Regexp, error) {
+	str, err := toStringE(args[0])
+	if err != nil {
+		return "", nil, err
+	}
+	re, err := toRegexp(args[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return str, re, nil
+}
+
+// groupIndex returns the index of a capture group
+// given by its number or its name, default group is 0 for the whole match
+func groupIndex(re *regexp.Regexp, args []any) (int, error) {
+	if len(args) < 3 {
+		return 0, nil
+	}
+	if name, ok := args[2].(string); ok {
+		if i := re.SubexpIndex(name); i >= 0 {
+			return i, nil
+		}
+		return 0, fmt.Errorf("unknown group: %s", name)
+	}
+	i, err := cast.ToIntE(unwrapNumber(args[2]))
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || i > re.NumSubexp() {
+		return 0, fmt.Errorf("unknown group: %d", i)
+	}
+	return i, nil
+}
+
+// regexMatchFunc is the regex match function
+// REGEX_MATCH(str, pattern)
+// if str contains a match of pattern, return true, else return false
+// use ^ and $ in pattern to match the whole str
+func regexMatchFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, re, err := regexArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString(str), nil
+}
+
+// regexExtractFunc is the regex extract function
+// REGEX_EXTRACT(str, pattern, group)
+// return the first match of pattern in str, or nil if there is none
+// group is the number or the name of the capture group to return
+// default group is 0 for the whole match
+func regexExtractFunc(args []any) (any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, re, err := regexArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupIndex(re, args)
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindStringSubmatchIndex(str)
+	if match == nil || match[2*group] < 0 {
+		return nil, nil
+	}
+	return str[match[2*group]:match[2*group+1]], nil
+}
+
+// regexExtractAllFunc is the regex extract all function
+// REGEX_EXTRACT_ALL(str, pattern, group)
+// return the array of all matches of pattern in str
+// group is the number or the name of the capture group to return
+// default group is 0 for the whole match
+func regexExtractAllFunc(args []any) (any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, re, err := regexArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	group, err := groupIndex(re, args)
+	if err != nil {
+		return nil, err
+	}
+	matches := re.FindAllStringSubmatchIndex(str, -1)
+	arr := make([]any, 0, len(matches))
+	for _, match := range matches {
+		if match[2*group] >= 0 {
+			arr = append(arr, str[match[2*group]:match[2*group+1]])
+		}
+	}
+	return arr, nil
+}
+
+// regexGroupsFunc is the regex groups function
+// REGEX_GROUPS(str, pattern)
+// return an object of the named capture groups
+// of the first match of pattern in str, or nil if there is none
+// a group that does not take part in the match is nil
+func regexGroupsFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, re, err := regexArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	match := re.FindStringSubmatchIndex(str)
+	if match == nil {
+		return nil, nil
+	}
+	groups := make(map[string]any)
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if match[2*i] < 0 {
+			groups[name] = nil
+			continue
+		}
+		groups[name] = str[match[2*i]:match[2*i+1]]
+	}
+	return groups, nil
+}
+
+// regexReplaceFunc is the regex replace function
+// REGEX_REPLACE(str, pattern, replacement)
+// return str with every match of pattern replaced by replacement
+// $1 or ${name} in replacement is the text of a capture group
+func regexReplaceFunc(args []any) (any, error) {
+	if len(args) != 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, re, err := regexArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	repl, err := toStringE(args[2])
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(str, repl), nil
+}
@@ -0,0 +1,314 @@
+package json2json
+
+import (
+	"fmt"
+	"github.com/spf13/cast"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxStringLen is the maximum length of a string
+// built by REPEAT, PAD_LEFT or PAD_RIGHT
+// so that a count read from the input cannot exhaust the memory
+const maxStringLen = 1 << 24
+
+// toStrings converts the arguments of a string function to strings
+func toStrings(args []any) ([]string, error) {
+	strs := make([]string, len(args))
+	for i, arg := range args {
+		str, err := toStringE(arg)
+		if err != nil {
+			return nil, err
+		}
+		strs[i] = str
+	}
+	return strs, nil
+}
+
+// upperFunc is the upper function
+// UPPER(str)
+// return str in upper case
+func upperFunc(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, err := toStringE(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToUpper(str), nil
+}
+
+// lowerFunc is the lower function
+// LOWER(str)
+// return str in lower case
+func lowerFunc(args []any) (any, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, err := toStringE(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return strings.ToLower(str), nil
+}
+
+// trimFunc is the trim function
+// TRIM(str, cutset)
+// return str without the leading and trailing characters in cutset
+// default cutset is whitespace
+func trimFunc(args []any) (any, error) {
+	return trim(args, strings.TrimFunc, strings.Trim)
+}
+
+// trimLeftFunc is the trim left function
+// TRIM_LEFT(str, cutset)
+// return str without the leading characters in cutset
+// default cutset is whitespace
+func trimLeftFunc(args []any) (any, error) {
+	return trim(args, strings.TrimLeftFunc, strings.TrimLeft)
+}
+
+// trimRightFunc is the trim right function
+// TRIM_RIGHT(str, cutset)
+// return str without the trailing characters in cutset
+// default cutset is whitespace
+func trimRightFunc(args []any) (any, error) {
+	return trim(args, strings.TrimRightFunc, strings.TrimRight)
+}
+
+// trim trims whitespace with trimFunc
+// or the characters of a cutset with trimCutset
+func trim(args []any, trimFunc func(string, func(rune) bool) string, trimCutset func(string, string) string) (any, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	if len(strs) == 1 {
+		return trimFunc(strs[0], unicode.IsSpace), nil
+	}
+	return trimCutset(strs[0], strs[1]), nil
+}
+
+// replaceFunc is the replace function
+// REPLACE(str, old, new, n)
+// return str with the first n occurrences of old replaced by new
+// default n is -1 to replace all occurrences
+func replaceFunc(args []any) (any, error) {
+	if len(args) < 3 || len(args) > 4 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args[:3])
+	if err != nil {
+		return nil, err
+	}
+	n := -1
+	if len(args) == 4 {
+		if n, err = cast.ToIntE(unwrapNumber(args[3])); err != nil {
+			return nil, err
+		}
+	}
+	return strings.Replace(strs[0], strs[1], strs[2], n), nil
+}
+
+// splitFunc is the split function
+// SPLIT(str, sep)
+// return the array of the substrings of str separated by sep
+// if sep is empty, str is split into characters
+func splitFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(strs[0], strs[1])
+	arr := make([]any, len(parts))
+	for i, part := range parts {
+		arr[i] = part
+	}
+	return arr, nil
+}
+
+// joinFunc is the join function
+// JOIN(arr, sep)
+// return the elements of arr converted to string and separated by sep
+func joinFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	elems, ok := toSlice(args[0])
+	if !ok {
+		return nil, fmt.Errorf("invalid type: %T", args[0])
+	}
+	strs, err := toStrings(elems)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := toStringE(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return strings.Join(strs, sep), nil
+}
+
+// concatFunc is the concat function
+// CONCAT(expr1, expr2, ...)
+// return the exprs converted to string and joined together
+func concatFunc(args []any) (any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Join(strs, ""), nil
+}
+
+// padLeftFunc is the pad left function
+// PAD_LEFT(str, length, pad)
+// return str padded at the start with pad up to length characters
+// default pad is a space
+func padLeftFunc(args []any) (any, error) {
+	return pad(args, true)
+}
+
+// padRightFunc is the pad right function
+// PAD_RIGHT(str, length, pad)
+// return str padded at the end with pad up to length characters
+// default pad is a space
+func padRightFunc(args []any) (any, error) {
+	return pad(args, false)
+}
+
+// pad pads a string at the start or at the end
+// the pad is repeated and cut to fill the missing characters
+func pad(args []any, left bool) (any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, err := toStringE(args[0])
+	if err != nil {
+		return nil, err
+	}
+	length, err := cast.ToIntE(unwrapNumber(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	padStr := " "
+	if len(args) == 3 {
+		if padStr, err = toStringE(args[2]); err != nil {
+			return nil, err
+		}
+		if padStr == "" {
+			return nil, fmt.Errorf("empty pad")
+		}
+	}
+	missing := length - utf8.RuneCountInString(str)
+	if missing <= 0 {
+		return str, nil
+	}
+	if length > maxStringLen {
+		return nil, fmt.Errorf("length too large: %d", length)
+	}
+	padRunes := []rune(padStr)
+	fill := make([]rune, missing)
+	for i := range fill {
+		fill[i] = padRunes[i%len(padRunes)]
+	}
+	if left {
+		return string(fill) + str, nil
+	}
+	return str + string(fill), nil
+}
+
+// containsFunc is the contains function
+// CONTAINS(str, substr)
+// if str contains substr, return true, else return false
+func containsFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Contains(strs[0], strs[1]), nil
+}
+
+// startsWithFunc is the starts with function
+// STARTS_WITH(str, prefix)
+// if str starts with prefix, return true, else return false
+func startsWithFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasPrefix(strs[0], strs[1]), nil
+}
+
+// endsWithFunc is the ends with function
+// ENDS_WITH(str, suffix)
+// if str ends with suffix, return true, else return false
+func endsWithFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	return strings.HasSuffix(strs[0], strs[1]), nil
+}
+
+// indexOfFunc is the index of function
+// INDEX_OF(str, substr)
+// return the character position of the first substr in str,
+// starting from 0, or -1 if str does not contain substr
+func indexOfFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	strs, err := toStrings(args)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.Index(strs[0], strs[1])
+	if i < 0 {
+		return -1, nil
+	}
+	return utf8.RuneCountInString(strs[0][:i]), nil
+}
+
+// repeatFunc is the repeat function
+// REPEAT(str, count)
+// return str repeated count times
+func repeatFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	str, err := toStringE(args[0])
+	if err != nil {
+		return nil, err
+	}
+	count, err := cast.ToIntE(unwrapNumber(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	if count < 0 {
+		return nil, fmt.Errorf("negative count: %d", count)
+	}
+	if count > 0 && len(str) > maxStringLen/count {
+		return nil, fmt.Errorf("count too large: %d", count)
+	}
+	return strings.Repeat(str, count), nil
+}
@@ -0,0 +1,445 @@
+package json2json
+
+import (
+	"fmt"
+	"github.com/spf13/cast"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// timeLayouts is a map that contains the named layouts
+// that can be used instead of a Go or strftime layout
+var timeLayouts = map[string]string{
+	"ANSIC":       time.ANSIC,
+	"RFC822":      time.RFC822,
+	"RFC822Z":     time.RFC822Z,
+	"RFC850":      time.RFC850,
+	"RFC1123":     time.RFC1123,
+	"RFC1123Z":    time.RFC1123Z,
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"Kitchen":     time.Kitchen,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// epochLayouts is a map that contains the layouts of epoch values
+// and the unit they count
+var epochLayouts = map[string]time.Duration{
+	"unix":    time.Second,
+	"unix_ms": time.Millisecond,
+	"unix_us": time.Microsecond,
+	"unix_ns": time.Nanosecond,
+}
+
+// strftimeDirectives is a map that contains the strftime directives
+// and the Go layout they are converted to
+var strftimeDirectives = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'f': "000000",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'D': "01/02/06",
+	'R': "15:04",
+	'%': "%",
+}
+
+// timeUnits is a map that contains the units of DIFF_TIME
+var timeUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  24 * time.Hour,
+}
+
+// layoutProbe is a time whose every element differs
+// from the reference time of Go layouts,
+// so a Go layout formats it to its own text only if it has no element
+var layoutProbe = time.Date(1999, 12, 31, 11, 58, 59, 987654321, time.FixedZone("XYZ", 3*60*60+30*60))
+
+// isStrftime checks if a layout is a strftime layout
+// a layout containing % is a strftime layout
+func isStrftime(layout string) bool {
+	return strings.Contains(layout, "%")
+}
+
+// toLayout converts a named, strftime or Go layout to a Go layout
+// a strftime layout whose literal text Go reads as layout elements,
+// like the 1 of 'day 1 %d' or a %f that does not follow . or ,
+// has no Go layout and is an error
+func toLayout(arg any) (string, error) {
+	layout, err := toStringE(arg)
+	if err != nil {
+		return "", err
+	}
+	if named, ok := timeLayouts[layout]; ok {
+		return named, nil
+	}
+	if !isStrftime(layout) {
+		return layout, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			b.WriteByte(layout[i])
+			continue
+		}
+		if i++; i == len(layout) {
+			return "", fmt.Errorf("invalid layout: %s", layout)
+		}
+		directive, ok := strftimeDirectives[layout[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported directive: %%%c", layout[i])
+		}
+		b.WriteString(directive)
+	}
+	want, err := formatStrftime(layoutProbe, layout)
+	if err != nil {
+		return "", err
+	}
+	if layoutProbe.Format(b.String()) != want {
+		return "", fmt.Errorf("ambiguous layout: %s", layout)
+	}
+	return b.String(), nil
+}
+
+// formatStrftime formats a time with a strftime layout
+// directive by directive, so the literal text is written as it is
+func formatStrftime(t time.Time, layout string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			b.WriteByte(layout[i])
+			continue
+		}
+		if i++; i == len(layout) {
+			return "", fmt.Errorf("invalid layout: %s", layout)
+		}
+		directive, ok := strftimeDirectives[layout[i]]
+		switch {
+		case !ok:
+			return "", fmt.Errorf("unsupported directive: %%%c", layout[i])
+		case layout[i] == 'f':
+			b.WriteString(fmt.Sprintf("%06d", t.Nanosecond()/int(time.Microsecond)))
+		case layout[i] == '%':
+			b.WriteByte('%')
+		default:
+			b.WriteString(t.Format(directive))
+		}
+	}
+	return b.String(), nil
+}
+
+// locations caches the loaded time zones by name,
+// so the zone database is read once per zone
+var locations sync.Map
+
+// toLocation loads an IANA time zone like Asia/Jakarta
+// default zone is UTC
+func toLocation(args []any, i int) (*time.Location, error) {
+	if len(args) <= i {
+		return time.UTC, nil
+	}
+	name, err := toStringE(args[i])
+	if err != nil {
+		return nil, err
+	}
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone: %s", name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// toTime converts a time or an RFC 3339 string to a time
+func toTime(arg any) (time.Time, error) {
+	switch v := arg.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time: %s", v)
+		}
+		return t, nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid time: %v", arg)
+	}
+}
+
+// parseEpoch converts an epoch value counting unit since 1970-01-01 UTC
+// to a time, a fraction of the unit is kept down to the nanosecond
+func parseEpoch(arg any, unit time.Duration) (time.Time, error) {
+	r, err := toRat(arg)
+	if err != nil {
+		return time.Time{}, err
+	}
+	r.Mul(r, new(big.Rat).SetInt64(int64(unit)))
+	ns := new(big.Int).Quo(r.Num(), r.Denom())
+	if !ns.IsInt64() {
+		return time.Time{}, fmt.Errorf("invalid time: %v", arg)
+	}
+	return time.Unix(0, ns.Int64()), nil
+}
+
+// parseDuration parses a Go duration like 1h30m
+// with an optional number of days first like 2d or -1d12h
+// a day is a calendar day in the zone of the time it is added to
+func parseDuration(arg any) (int, time.Duration, error) {
+	str, err := toStringE(arg)
+	if err != nil {
+		return 0, 0, err
+	}
+	s, sign := str, 1
+	if strings.HasPrefix(s, "-") {
+		s, sign = s[1:], -1
+	} else {
+		s = strings.TrimPrefix(s, "+")
+	}
+	days := 0
+	if i := strings.IndexByte(s, 'd'); i >= 0 {
+		if days, err = strconv.Atoi(s[:i]); err != nil || days < 0 {
+			return 0, 0, fmt.Errorf("invalid duration: %s", str)
+		}
+		if s = s[i+1:]; s == "" {
+			return sign * days, 0, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || strings.ContainsAny(s, "+-") {
+		return 0, 0, fmt.Errorf("invalid duration: %s", str)
+	}
+	return sign * days, time.Duration(sign) * d, nil
+}
+
+// nowFunc is the now function
+// NOW()
+// return the current time in UTC
+// the clock can be replaced with WithClock
+func nowFunc(p *Parser, args []any) (any, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	return p.clock().UTC(), nil
+}
+
+// parseTimeFunc is the parse time function
+// PARSE_TIME(value, layout, zone)
+// return value parsed as a time with layout
+// layout is a Go layout like 2006-01-02, a strftime layout like %Y-%m-%d,
+// a named layout like RFC3339 or an epoch layout unix, unix_ms, unix_us or unix_ns
+// a strftime layout whose literal text Go reads as layout elements is an error
+// zone is the IANA zone of a value without offset and of an epoch value
+// default zone is UTC
+func parseTimeFunc(args []any) (any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	loc, err := toLocation(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	if unit, ok := epochLayouts[cast.ToString(args[1])]; ok {
+		t, err := parseEpoch(args[0], unit)
+		if err != nil {
+			return nil, err
+		}
+		return t.In(loc), nil
+	}
+	str, err := toStringE(args[0])
+	if err != nil {
+		return nil, err
+	}
+	layout, err := toLayout(args[1])
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.ParseInLocation(layout, str, loc)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time: %w", err)
+	}
+	return t, nil
+}
+
+// formatTimeFunc is the format time function
+// FORMAT_TIME(time, layout, zone)
+// return time formatted with layout, layouts are the same as PARSE_TIME
+// a strftime layout is formatted directive by directive,
+// so its literal text is written as it is
+// an epoch layout returns an integer
+// zone is the IANA zone to format time in
+// default zone is the zone of time
+func formatTimeFunc(args []any) (any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 {
+		loc, err := toLocation(args, 2)
+		if err != nil {
+			return nil, err
+		}
+		t = t.In(loc)
+	}
+	if unit, ok := epochLayouts[cast.ToString(args[1])]; ok {
+		return t.Unix()*int64(time.Second/unit) + int64(t.Nanosecond())/int64(unit), nil
+	}
+	if layout, ok := args[1].(string); ok && isStrftime(layout) {
+		return formatStrftime(t, layout)
+	}
+	layout, err := toLayout(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return t.Format(layout), nil
+}
+
+// toZoneFunc is the to zone function
+// TO_ZONE(time, zone)
+// return the same instant as time in the IANA zone
+func toZoneFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	loc, err := toLocation(args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return t.In(loc), nil
+}
+
+// addTimeFunc is the add time function
+// ADD_TIME(time, duration)
+// return time plus duration like 1h30m, 2d or -1d12h
+func addTimeFunc(args []any) (any, error) {
+	return addTime(args, 1)
+}
+
+// subTimeFunc is the sub time function
+// SUB_TIME(time, duration)
+// return time minus duration like 1h30m, 2d or -1d12h
+func subTimeFunc(args []any) (any, error) {
+	return addTime(args, -1)
+}
+
+// addTime adds a duration with the given sign to a time
+func addTime(args []any, sign int) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	days, d, err := parseDuration(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return t.AddDate(0, 0, sign*days).Add(time.Duration(sign) * d), nil
+}
+
+// truncateTimeFunc is the truncate time function
+// TRUNCATE_TIME(time, unit)
+// return time truncated to the start of the
+// year, month, day, hour, minute or second in the zone of time
+func truncateTimeFunc(args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	t, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	unit, err := toStringE(args[1])
+	if err != nil {
+		return nil, err
+	}
+	y, mo, d := t.Date()
+	h, mi, s := t.Clock()
+	switch unit {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, t.Location()), nil
+	case "month":
+		return time.Date(y, mo, 1, 0, 0, 0, 0, t.Location()), nil
+	case "day":
+		return time.Date(y, mo, d, 0, 0, 0, 0, t.Location()), nil
+	case "hour":
+		return time.Date(y, mo, d, h, 0, 0, 0, t.Location()), nil
+	case "minute":
+		return time.Date(y, mo, d, h, mi, 0, 0, t.Location()), nil
+	case "second":
+		return time.Date(y, mo, d, h, mi, s, 0, t.Location()), nil
+	default:
+		return nil, fmt.Errorf("invalid unit: %s", unit)
+	}
+}
+
+// diffTimeFunc is the diff time function
+// DIFF_TIME(time1, time2, unit)
+// return time1 - time2 in unit ns, us, ms, s, m, h or d
+// the result is an integer if it is a whole number of units
+// default unit is s
+func diffTimeFunc(args []any) (any, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, fmt.Errorf("invalid number of arguments: %d", len(args))
+	}
+	t1, err := toTime(args[0])
+	if err != nil {
+		return nil, err
+	}
+	t2, err := toTime(args[1])
+	if err != nil {
+		return nil, err
+	}
+	unit := time.Second
+	if len(args) == 3 {
+		name, err := toStringE(args[2])
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		if unit, ok = timeUnits[name]; !ok {
+			return nil, fmt.Errorf("invalid unit: %s", name)
+		}
+	}
+	d := t1.Sub(t2)
+	if d%unit == 0 {
+		return int64(d / unit), nil
+	}
+	return float64(d) / float64(unit), nil
+}
@@ -2,7 +2,11 @@ package json2json
 
 import (
 	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"os"
 )
 
 type Json2Json struct {
@@ -10,20 +14,32 @@ type Json2Json struct {
 	outputWriter io.Writer
 
 	inputSampleReader io.Reader
-	processReader     io.Reader
+	proc              *process
 
-	fn func(r io.Reader, w io.Writer)
+	fn          func(r io.Reader, w io.Writer)
+	inputFn     func(r io.Reader, w io.Writer)
+	errorPolicy ErrorPolicy
+	keyPolicies []keyErrorPolicy
+	parserOpts  []ParserOpt
+
+	err       error
+	recordErr error
 }
 
 type Opt func(*Json2Json)
 
+// keyErrorPolicy is the error policy of a key set with an Opt
+type keyErrorPolicy struct {
+	key    string
+	policy KeyErrorPolicy
+}
+
 func New(r io.Reader, w io.Writer, opts ...Opt) *Json2Json {
 	j := Json2Json{
 		inputReader:  r,
 		outputWriter: w,
 
 		inputSampleReader: bytes.NewReader([]byte{}),
-		processReader:     bytes.NewReader([]byte{}),
 	}
 	for _, opt := range opts {
 		opt(&j)
@@ -31,31 +47,157 @@ func New(r io.Reader, w io.Writer, opts ...Opt) *Json2Json {
 	return &j
 }
 
+// WithMiddlewareFn sets a function that WriteOutput calls
+// with the input reader and the output writer instead of the process spec
 func WithMiddlewareFn(fn func(r io.Reader, w io.Writer)) Opt {
 	return func(j *Json2Json) {
 		j.fn = fn
 	}
 }
 
+// WithInputFn sets a function that is run on the raw input
+// before it is mapped, whatever fn writes to w is used as the input
+func WithInputFn(fn func(r io.Reader, w io.Writer)) Opt {
+	return func(j *Json2Json) {
+		j.inputFn = fn
+	}
+}
+
+// WithErrorPolicy sets what happens when a key of the process spec fails,
+// to compile in ReadConfig or to evaluate in WriteOutput,
+// the default is FailFast
+func WithErrorPolicy(policy ErrorPolicy) Opt {
+	return func(j *Json2Json) {
+		j.errorPolicy = policy
+	}
+}
+
+// WithKeyErrorPolicy sets what happens when a single key of the process spec fails,
+// it overrides the on_error of the key in the process spec,
+// a key that is not in the process spec fails ReadConfig
+func WithKeyErrorPolicy(key string, policy KeyErrorPolicy) Opt {
+	return func(j *Json2Json) {
+		j.keyPolicies = append(j.keyPolicies, keyErrorPolicy{key: key, policy: policy})
+	}
+}
+
+// WithParserOpts sets the options of the parser
+// that evaluates the expressions of the process spec
+func WithParserOpts(opts ...ParserOpt) Opt {
+	return func(j *Json2Json) {
+		j.parserOpts = append(j.parserOpts, opts...)
+	}
+}
+
+// ReadInput sets the input JSON document from bytes
+// it clears the error of the previous input
 func (j *Json2Json) ReadInput(b []byte) *Json2Json {
+	j.inputReader = bytes.NewReader(b)
+	j.recordErr = nil
 	return j
 }
 
+// ReadInputFile sets the input JSON document from a file
+// it clears the error of the previous input
 func (j *Json2Json) ReadInputFile(filepath string) *Json2Json {
-	return j
+	if j.err != nil {
+		return j
+	}
+	b, err := os.ReadFile(filepath)
+	if err != nil {
+		j.recordErr = fmt.Errorf("read input file: %w", err)
+		return j
+	}
+	return j.ReadInput(b)
 }
 
+// ReadConfig reads and compiles the process spec from bytes
+// the compiled spec is reused by every WriteOutput,
+// so one Json2Json can map many inputs with ReadInput and WriteOutput
 func (j *Json2Json) ReadConfig(b []byte) *Json2Json {
+	if j.err != nil {
+		return j
+	}
+	proc, err := readProcess(bytes.NewReader(b), j.errorPolicy)
+	if err != nil {
+		j.err = err
+		return j
+	}
+	for _, kp := range j.keyPolicies {
+		if err = proc.setPolicy(kp.key, kp.policy); err != nil {
+			j.err = err
+			return j
+		}
+	}
+	j.proc = proc
 	return j
 }
 
+// ReadConfigFile reads and compiles the process spec from a file
 func (j *Json2Json) ReadConfigFile(filepath string) *Json2Json {
-	return j
+	if j.err != nil {
+		return j
+	}
+	b, err := os.ReadFile(filepath)
+	if err != nil {
+		j.err = fmt.Errorf("read config file: %w", err)
+		return j
+	}
+	return j.ReadConfig(b)
 }
 
+// WriteOutput maps the input with the process spec
+// and writes the resulting JSON document to the output writer
+// an error of the input is kept until the next ReadInput,
+// an error of the process spec is kept for good
 func (j *Json2Json) WriteOutput() *Json2Json {
+	if j.err != nil || j.recordErr != nil {
+		return j
+	}
+	inputReader := j.inputReader
+	if j.inputFn != nil {
+		var buf bytes.Buffer
+		j.inputFn(inputReader, &buf)
+		inputReader = &buf
+	}
 	if j.fn != nil {
-		j.fn(j.inputReader, j.outputWriter)
+		j.fn(inputReader, j.outputWriter)
+		return j
+	}
+	if j.proc == nil {
+		j.recordErr = fmt.Errorf("no process spec")
+		return j
+	}
+	var input map[string]any
+	dec := json.NewDecoder(inputReader)
+	dec.UseNumber()
+	if err := dec.Decode(&input); err != nil {
+		j.recordErr = fmt.Errorf("decode input: %w", err)
+		return j
+	}
+	output, err := j.proc.run(input, j.errorPolicy, j.parserOpts...)
+	if err != nil {
+		j.recordErr = err
+		if output == nil || j.errorPolicy != CollectAndContinue {
+			return j
+		}
+	}
+	b, err := json.MarshalIndent(output, "", "  ")
+	if err != nil {
+		j.recordErr = errors.Join(j.recordErr, fmt.Errorf("encode output: %w", err))
+		return j
+	}
+	if _, err = j.outputWriter.Write(b); err != nil {
+		j.recordErr = errors.Join(j.recordErr, fmt.Errorf("write output: %w", err))
 	}
 	return j
 }
+
+// Err returns the error that happened while reading or writing
+// with a collecting error policy, it is a MultiError of the failing keys
+func (j *Json2Json) Err() error {
+	if j.err != nil {
+		return j.err
+	}
+	return j.recordErr
+}
@@ -0,0 +1,631 @@
+package json2json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestJson2Json_WriteOutput(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		input   string
+		process string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "simple keys",
+			input:   `{"a": "hello", "b": 2}`,
+			process: `{"x": "STRING([a])", "y": "FLOAT([b]*2,1)", "z": "NIL"}`,
+			want:    `{"x":"hello","y":4.0,"z":null}`,
+			wantErr: false,
+		},
+		{
+			name:    "float results inside expressions",
+			input:   `{"w": 2}`,
+			process: `{"f": "FLOAT([w],1)", "label": "CONCAT(STRING(FLOAT([w],1)),' kg')", "n": "INT(FLOAT([w]*1.25,2))"}`,
+			want:    `{"f":2.0,"label":"2 kg","n":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "nested keys in process order",
+			input:   `{"a": {"b": "c"}}`,
+			process: `{"z.y": "STRING([a.b])", "z.x": "LEN([a])", "w": "TRUE"}`,
+			want:    `{"z":{"y":"c","x":1},"w":true}`,
+			wantErr: false,
+		},
+		{
+			name:    "object guard true",
+			input:   `{"a": "abc"}`,
+			process: `{"z": "OBJECT([a]<>'', NIL)", "z.a": "STRING([a])"}`,
+			want:    `{"z":{"a":"abc"}}`,
+			wantErr: false,
+		},
+		{
+			name:    "object guard default",
+			input:   `{"a": ""}`,
+			process: `{"z": "OBJECT([a]<>'', NIL)", "z.a": "STRING([a])"}`,
+			want:    `{"z":null}`,
+			wantErr: false,
+		},
+		{
+			name:    "switch on input number",
+			input:   `{"s": 1, "f": 2.5}`,
+			process: `{"s": "SWITCH([s], 1, 'one', 'other')", "f": "SWITCH([f], 2.5, 'half', 'other')"}`,
+			want:    `{"s":"one","f":"half"}`,
+			wantErr: false,
+		},
+		{
+			name:    "array fan-out",
+			input:   `{"a": "x", "items": [{"id": 1, "n": 2}, {"id": 2, "n": 3}]}`,
+			process: `{"list": "ARRAY([items], EMPTY_ARRAY)", "list.id": "INT([items.id])", "list.total": "[items.n]*2", "list.a": "STRING([a])"}`,
+			want:    `{"list":[{"id":1,"total":4,"a":"x"},{"id":2,"total":6,"a":"x"}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "array fan-out with explicit index",
+			input:   `{"items": [{"id": 1, "n": 2}, {"id": 2, "n": 3}]}`,
+			process: `{"list": "ARRAY([items], EMPTY_ARRAY)", "list.id": "INT([items.id])", "list.first": "[items[0].id]", "list.second": "[items.1.id]", "list.head": "[items[0:1]]", "list.len": "LEN([items])", "list.sum": "REDUCE([items], (acc, x) => acc + x.n, 0)"}`,
+			want:    `{"list":[{"id":1,"first":1,"second":2,"head":[{"id":1,"n":2}],"len":2,"sum":5},{"id":2,"first":1,"second":2,"head":[{"id":1,"n":2}],"len":2,"sum":5}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "array fan-out with wildcard and descent",
+			input:   `{"items": [{"id": 1}, {"id": 2}]}`,
+			process: `{"list": "ARRAY([items], EMPTY_ARRAY)", "list.id": "INT([items.id])", "list.all": "[items.*.id]", "list.any": "[items..id]"}`,
+			want:    `{"list":[{"id":1,"all":[1,2],"any":[1,2]},{"id":2,"all":[1,2],"any":[1,2]}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "array fan-out default",
+			input:   `{"items": "none"}`,
+			process: `{"list": "ARRAY([items], EMPTY_ARRAY)", "list.id": "INT([items.id])"}`,
+			want:    `{"list":[]}`,
+			wantErr: false,
+		},
+		{
+			name:    "nested array fan-out",
+			input:   `{"items": [{"id": 1, "tags": [{"v": "a"}, {"v": "b"}]}, {"id": 2, "tags": []}]}`,
+			process: `{"list": "ARRAY([items], EMPTY_ARRAY)", "list.id": "INT([items.id])", "list.tags": "ARRAY([items.tags], EMPTY_ARRAY)", "list.tags.v": "STRING([items.tags.v])", "list.tags.id": "INT([items.id])"}`,
+			want:    `{"list":[{"id":1,"tags":[{"v":"a","id":1},{"v":"b","id":1}]},{"id":2,"tags":[]}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "variables in dependency order",
+			input:   `{"a": 2}`,
+			process: `{"x": "VAR('var_b', 0)", "var_b": "SET(3*VAR('var_a', 0))", "var_a": "SET([a]+1)"}`,
+			want:    `{"x":9}`,
+			wantErr: false,
+		},
+		{
+			name:    "error variable cycle",
+			input:   `{}`,
+			process: `{"x": "VAR('var_a', 0)", "var_a": "SET(VAR('var_b', 0))", "var_b": "SET(VAR('var_a', 0))"}`,
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "no param omits key and children",
+			input:   `{"a": ""}`,
+			process: `{"z": "OBJECT([a]<>'', NO_PARAM)", "z.a": "STRING([a])", "y": "NO_PARAM", "x": "NIL"}`,
+			want:    `{"x":null}`,
+			wantErr: false,
+		},
+		{
+			name:    "quoted and escaped keys",
+			input:   `{"shipping.fee": 5}`,
+			process: `{"data.'shipping.fee'": "['shipping.fee']", "data.shipping\\.cost": "[shipping\\.fee]"}`,
+			want:    `{"data":{"shipping.fee":5,"shipping.cost":5}}`,
+			wantErr: false,
+		},
+		{
+			name:    "missing key is not touched",
+			input:   `{"name": null}`,
+			process: `{"name": "IF(EXISTS([name]), [name], NO_PARAM)", "nick": "IF(EXISTS([nick]), [nick], NO_PARAM)", "label": "COALESCE([nick], [name], 'anonymous')"}`,
+			want:    `{"name":null,"label":"anonymous"}`,
+			wantErr: false,
+		},
+		{
+			name:    "jsonpath",
+			input:   `{"tn": "TN1", "packages": [{"sku": "a", "quantity": 1}, {"sku": "b", "quantity": 2}]}`,
+			process: `{"tn": "$.tn", "skus": "$.packages[?@.quantity > 1].sku", "count": "LEN($.packages[*])"}`,
+			want:    `{"tn":"TN1","skus":["b"],"count":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "json pointer keys",
+			input:   `{"fee": 5, "items": [{"id": 1}, {"id": 2}]}`,
+			process: `{"/data/shipping.fee": "[/fee]", "/data/a~1b": "[/items/0/id]", "/list": "ARRAY([/items], EMPTY_ARRAY)", "/list/id": "[/items/id]"}`,
+			want:    `{"data":{"shipping.fee":5,"a/b":1},"list":[{"id":1},{"id":2}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "relative keys",
+			input:   `{"tracking_number": "TN1", "packages": [{"sku": "a", "items": [{"n": 1}, {"n": 2}]}, {"sku": "b", "items": []}]}`,
+			process: `{"rows": "ARRAY([packages], EMPTY_ARRAY)", "rows.sku": "[@.sku]", "rows.tn": "[$.tracking_number]", "rows.position": "INDEX()", "rows.items": "ARRAY([@.items], EMPTY_ARRAY)", "rows.items.n": "[@.n]", "rows.items.sku": "[^.sku]", "rows.items.position": "INDEX()"}`,
+			want:    `{"rows":[{"sku":"a","tn":"TN1","position":0,"items":[{"n":1,"sku":"a","position":0},{"n":2,"sku":"a","position":1}]},{"sku":"b","tn":"TN1","position":1,"items":[]}]}`,
+			wantErr: false,
+		},
+		{
+			name:    "rounding",
+			input:   `{"weight": 2.01, "total": 10.125}`,
+			process: `{"chargeable": "CEIL([weight])", "total": "ROUND([total], 2, 'HALF_EVEN')", "capped": "CLAMP([weight], 0, 2)"}`,
+			want:    `{"chargeable":3,"total":10.12,"capped":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "lambdas",
+			input:   `{"packages": [{"sku": "a", "quantity": 2, "item_weight": 1.5}, {"sku": "b", "quantity": 0, "item_weight": 3}]}`,
+			process: `{"total_weight": "REDUCE([packages], (sum, x) => sum + x.quantity * x.item_weight, 0)", "skus": "MAP(FILTER([packages], x => x.quantity > 0), x => x.sku)"}`,
+			want:    `{"total_weight":3,"skus":["a"]}`,
+			wantErr: false,
+		},
+		{
+			name:    "fractional input numbers",
+			input:   `{"f": 2.5, "n": 3.0, "s": "abcdef"}`,
+			process: `{"i": "INT([f])", "n": "INT([n])", "slice": "SLICE_STR([s], [f], 5.9)", "pad": "PAD_LEFT('7', [f], '0')"}`,
+			want:    `{"i":2,"n":3,"slice":"cde","pad":"07"}`,
+			wantErr: false,
+		},
+		{
+			name:    "guarded division",
+			input:   `{"z": 0}`,
+			process: `{"x": "IF([z]=0,0,1/[z])", "y": "IF([z]<>0,1/[z],NIL)"}`,
+			want:    `{"x":0,"y":null}`,
+			wantErr: false,
+		},
+		{
+			name:    "error division by zero",
+			input:   `{"a": 1, "b": 0}`,
+			process: `{"x": "[a] / [b]", "y": "SAFE_DIV([a], [b], 0)"}`,
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "error expression",
+			input:   `{"a": "abc"}`,
+			process: `{"x": "INT()"}`,
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "error duplicate key",
+			input:   `{}`,
+			process: `{"x": "TRUE", "x": "FALSE"}`,
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "error duplicate key after split",
+			input:   `{}`,
+			process: `{"a.b": "2", "/a/b": "3"}`,
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "error duplicate quoted key",
+			input:   `{}`,
+			process: `{"a.b": "2", "a.'b'": "3"}`,
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "error input",
+			input:   `[]`,
+			process: `{"x": "TRUE"}`,
+			want:    ``,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			err := New(bytes.NewReader([]byte(tt.input)), &buf).
+				ReadConfig([]byte(tt.process)).
+				WriteOutput().
+				Err()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Json2Json.WriteOutput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := compact(t, buf.Bytes()); got != tt.want {
+				t.Errorf("Json2Json.WriteOutput() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJson2Json_WriteOutputError(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	err := New(bytes.NewReader([]byte(`{"a": "x"}`)), &buf).
+		ReadConfig([]byte(`{"data.tn": "STRING([a])", "data.qty": "INT([a])"}`)).
+		WriteOutput().
+		Err()
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Json2Json.WriteOutput() error = %v, want *Error", err)
+	}
+	if e.Key != "data.qty" || e.Expr != "INT([a])" {
+		t.Errorf("Error key, expr = %s, %s, want data.qty, INT([a])", e.Key, e.Expr)
+	}
+}
+
+func TestJson2Json_Fn(t *testing.T) {
+	t.Parallel()
+
+	const (
+		input   = `{"a": 1}`
+		process = `{"b": "[a] + 1"}`
+	)
+	var buf bytes.Buffer
+	middleware := func(r io.Reader, w io.Writer) {
+		_, _ = io.Copy(w, r)
+	}
+	err := New(bytes.NewReader([]byte(input)), &buf, WithMiddlewareFn(middleware)).
+		ReadConfig([]byte(process)).
+		WriteOutput().
+		Err()
+	if err != nil {
+		t.Fatalf("Json2Json.WriteOutput() with middleware error = %v", err)
+	}
+	if got := buf.String(); got != input {
+		t.Errorf("Json2Json.WriteOutput() with middleware = %s, want %s", got, input)
+	}
+
+	buf.Reset()
+	unwrap := func(r io.Reader, w io.Writer) {
+		b, _ := io.ReadAll(r)
+		_, _ = w.Write(bytes.TrimPrefix(b, []byte(")]}'")))
+	}
+	err = New(bytes.NewReader([]byte(")]}'"+input)), &buf, WithInputFn(unwrap)).
+		ReadConfig([]byte(process)).
+		WriteOutput().
+		Err()
+	if err != nil {
+		t.Fatalf("Json2Json.WriteOutput() with input fn error = %v", err)
+	}
+	if got, want := compact(t, buf.Bytes()), `{"b":2}`; got != want {
+		t.Errorf("Json2Json.WriteOutput() with input fn = %s, want %s", got, want)
+	}
+}
+
+func TestJson2Json_Reuse(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	j := New(nil, &buf).ReadConfig([]byte(`{"tn": "STRING([tracking_number])", "qty": "INT([quantity])"}`))
+	inputs := []string{
+		`{"tracking_number": "TN1", "quantity": 1}`,
+		`{"tracking_number": "TN2", "quantity": "x"}`,
+		`{"tracking_number": "TN3", "quantity": 3}`,
+		`{`,
+		`{"tracking_number": "TN5", "quantity": 5}`,
+	}
+	wants := []string{
+		`{"tn":"TN1","qty":1}`,
+		``,
+		`{"tn":"TN3","qty":3}`,
+		``,
+		`{"tn":"TN5","qty":5}`,
+	}
+	for i, input := range inputs {
+		buf.Reset()
+		err := j.ReadInput([]byte(input)).WriteOutput().Err()
+		if (err != nil) != (wants[i] == "") {
+			t.Fatalf("Json2Json.WriteOutput() #%d error = %v, wantErr %v", i, err, wants[i] == "")
+		}
+		if err != nil {
+			continue
+		}
+		if got := compact(t, buf.Bytes()); got != wants[i] {
+			t.Errorf("Json2Json.WriteOutput() #%d = %s, want %s", i, got, wants[i])
+		}
+	}
+
+	err := New(bytes.NewReader([]byte(`{}`)), &buf).WriteOutput().Err()
+	if err == nil {
+		t.Errorf("Json2Json.WriteOutput() without process spec error = nil, want error")
+	}
+}
+
+func TestJson2Json_Numbers(t *testing.T) {
+	t.Parallel()
+
+	const (
+		input   = `{"id": 12345678901234567890, "n": 9007199254740993, "a": 0.1, "b": 0.2}`
+		process = `{"id": "[id]", "next": "[n]+1", "sum": "[a]+[b]"}`
+	)
+	tests := []struct {
+		name string
+		opts []Opt
+		want string
+	}{
+		{
+			name: "float",
+			want: `{"id":12345678901234567890,"next":9007199254740994,"sum":0.30000000000000004}`,
+		},
+		{
+			name: "decimal",
+			opts: []Opt{WithParserOpts(WithDecimal(DefaultDecimalScale))},
+			want: `{"id":12345678901234567890,"next":9007199254740994,"sum":0.3}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			err := New(bytes.NewReader([]byte(input)), &buf, tt.opts...).
+				ReadConfig([]byte(process)).
+				WriteOutput().
+				Err()
+			if err != nil {
+				t.Fatalf("Json2Json.WriteOutput() error = %v", err)
+			}
+			if got := compact(t, buf.Bytes()); got != tt.want {
+				t.Errorf("Json2Json.WriteOutput() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJson2Json_Clock(t *testing.T) {
+	t.Parallel()
+
+	const (
+		input   = `{"shipped_at": "2024-03-09 22:15:30"}`
+		process = `{"shipped_at": "TO_ZONE(PARSE_TIME([shipped_at], 'DateTime', 'Asia/Jakarta'), 'UTC')", "age_hours": "DIFF_TIME(NOW(), PARSE_TIME([shipped_at], 'DateTime', 'Asia/Jakarta'), 'h')", "generated_at": "NOW()"}`
+		want    = `{"shipped_at":"2024-03-09T15:15:30Z","age_hours":2.7416666666666667,"generated_at":"2024-03-09T18:00:00Z"}`
+	)
+	clock := func() time.Time {
+		return time.Date(2024, 3, 9, 18, 0, 0, 0, time.UTC)
+	}
+	var buf bytes.Buffer
+	err := New(bytes.NewReader([]byte(input)), &buf, WithParserOpts(WithClock(clock))).
+		ReadConfig([]byte(process)).
+		WriteOutput().
+		Err()
+	if err != nil {
+		t.Fatalf("Json2Json.WriteOutput() error = %v", err)
+	}
+	if got := compact(t, buf.Bytes()); got != want {
+		t.Errorf("Json2Json.WriteOutput() = %s, want %s", got, want)
+	}
+}
+
+func TestJson2Json_ErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	const (
+		input         = `{"a": "x", "b": 2}`
+		process       = `{"x": "INT([a])", "y": "INT([b])", "z": "STRING()", "var_a": "SET(FLOAT([a]))"}`
+		brokenProcess = `{"a": "STRING(", "b": "INT([b])", "c": "INT([x]", "d": "1/0", "e": "1 +"}`
+	)
+	tests := []struct {
+		name     string
+		process  string
+		policy   ErrorPolicy
+		want     string
+		wantErrs int
+	}{
+		{
+			name:     "fail fast",
+			process:  process,
+			policy:   FailFast,
+			want:     ``,
+			wantErrs: 1,
+		},
+		{
+			name:     "collect and fail",
+			process:  process,
+			policy:   CollectAndFail,
+			want:     ``,
+			wantErrs: 3,
+		},
+		{
+			name:     "collect and continue",
+			process:  process,
+			policy:   CollectAndContinue,
+			want:     `{"y":2}`,
+			wantErrs: 3,
+		},
+		{
+			name:     "fail fast on compile error",
+			process:  brokenProcess,
+			policy:   FailFast,
+			want:     ``,
+			wantErrs: 1,
+		},
+		{
+			name:     "collect and fail on compile errors",
+			process:  brokenProcess,
+			policy:   CollectAndFail,
+			want:     ``,
+			wantErrs: 3,
+		},
+		{
+			name:     "collect and continue on compile errors",
+			process:  brokenProcess,
+			policy:   CollectAndContinue,
+			want:     `{"b":2}`,
+			wantErrs: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			err := New(bytes.NewReader([]byte(input)), &buf, WithErrorPolicy(tt.policy)).
+				ReadConfig([]byte(tt.process)).
+				WriteOutput().
+				Err()
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Json2Json.WriteOutput() error = %v, want *Error", err)
+			}
+			errs := 1
+			var multi MultiError
+			if errors.As(err, &multi) {
+				errs = len(multi)
+			}
+			if errs != tt.wantErrs {
+				t.Errorf("Json2Json.WriteOutput() got %d errors, want %d: %v", errs, tt.wantErrs, err)
+			}
+			if got := compact(t, buf.Bytes()); got != tt.want {
+				t.Errorf("Json2Json.WriteOutput() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJson2Json_KeyErrorPolicy(t *testing.T) {
+	t.Parallel()
+
+	const input = `{"a": "x", "b": 2}`
+	tests := []struct {
+		name    string
+		process string
+		opts    []Opt
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "default in process",
+			process: `{"x": {"expr": "INT([a])", "on_error": "default", "default": "[b]*10"}, "y": "INT([b])"}`,
+			want:    `{"x":20,"y":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "default implied in process",
+			process: `{"x": {"expr": "INT([a])", "default": "'none'"}}`,
+			want:    `{"x":"none"}`,
+			wantErr: false,
+		},
+		{
+			name:    "null in process",
+			process: `{"x": {"expr": "INT([a])", "on_error": "null"}, "y": "INT([b])"}`,
+			want:    `{"x":null,"y":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "omit in process",
+			process: `{"x": {"expr": "INT([a])", "on_error": "omit"}, "y": "INT([b])"}`,
+			want:    `{"y":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "omit variable",
+			process: `{"x": "VAR('var_a', 0)", "var_a": {"expr": "SET(INT([a]))", "on_error": "omit"}}`,
+			want:    `{"x":0}`,
+			wantErr: false,
+		},
+		{
+			name:    "fail in process with collecting policy",
+			process: `{"x": {"expr": "INT([a])", "on_error": "fail"}, "y": "INT([b])"}`,
+			opts:    []Opt{WithErrorPolicy(CollectAndContinue)},
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "opt overrides process",
+			process: `{"x": {"expr": "INT([a])", "on_error": "fail"}, "y": "INT([b])"}`,
+			opts:    []Opt{WithKeyErrorPolicy("x", KeyErrorPolicy{OnError: OnErrorNull})},
+			want:    `{"x":null,"y":2}`,
+			wantErr: false,
+		},
+		{
+			name:    "error duplicate key with collecting policy",
+			process: `{"x": "INT([b])", "/x": "INT([b])"}`,
+			opts:    []Opt{WithErrorPolicy(CollectAndContinue)},
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "error opt for unknown key",
+			process: `{"x": "INT([b])"}`,
+			opts:    []Opt{WithKeyErrorPolicy("typo", KeyErrorPolicy{OnError: OnErrorNull})},
+			want:    ``,
+			wantErr: true,
+		},
+		{
+			name:    "failing default follows error policy",
+			process: `{"x": {"expr": "INT([a])", "default": "INT([a])"}, "y": "INT([b])"}`,
+			opts:    []Opt{WithErrorPolicy(CollectAndContinue)},
+			want:    `{"y":2}`,
+			wantErr: true,
+		},
+		{
+			name:    "error unknown on_error",
+			process: `{"x": {"expr": "INT([a])", "on_error": "retry"}}`,
+			want:    ``,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var buf bytes.Buffer
+			err := New(bytes.NewReader([]byte(input)), &buf, tt.opts...).
+				ReadConfig([]byte(tt.process)).
+				WriteOutput().
+				Err()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Json2Json.WriteOutput() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got := compact(t, buf.Bytes()); got != tt.want {
+				t.Errorf("Json2Json.WriteOutput() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJson2Json_Example(t *testing.T) {
+	t.Parallel()
+
+	want, err := os.ReadFile("example/trackingnumber/output.json")
+	if err != nil {
+		t.Fatalf("error reading output: %v", err)
+	}
+	var buf bytes.Buffer
+	err = New(nil, &buf).
+		ReadInputFile("example/trackingnumber/input.json").
+		ReadConfigFile("example/trackingnumber/process.json").
+		WriteOutput().
+		Err()
+	if err != nil {
+		t.Fatalf("Json2Json.WriteOutput() error = %v", err)
+	}
+	if got := buf.String(); got != string(want) {
+		t.Errorf("Json2Json.WriteOutput() = %s, want %s", got, want)
+	}
+}
+
+func compact(t *testing.T, b []byte) string {
+	t.Helper()
+	if len(b) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		t.Fatalf("error compacting output: %v", err)
+	}
+	return buf.String()
+}
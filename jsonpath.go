@@ -0,0 +1,903 @@
+package json2json
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// jsonPath is a JSONPath query (RFC 9535)
+// e.g. $.packages[?@.quantity > 1].sku
+type jsonPath struct {
+	segments []jsonPathSegment
+}
+
+// jsonPathSegment is a child segment like .a or [0, 1]
+// or a descendant segment like ..a or ..[0]
+type jsonPathSegment struct {
+	descendant bool
+	selectors  []jsonPathSelector
+}
+
+// selectorKind is the kind of a JSONPath selector
+type selectorKind int
+
+const (
+	// selectorName is a member name, e.g. a in $.a or $['a']
+	selectorName selectorKind = iota
+	// selectorWildcard is every child, e.g. $.* or $[*]
+	selectorWildcard
+	// selectorIndex is an array index, e.g. $[-1]
+	selectorIndex
+	// selectorSlice is an array slice, e.g. $[1:5:2]
+	selectorSlice
+	// selectorFilter is every child the filter is true for,
+	// e.g. $[?@.quantity > 1]
+	selectorFilter
+)
+
+// jsonPathSelector selects the children of a node
+type jsonPathSelector struct {
+	kind     selectorKind
+	name     string
+	index    int
+	start    int
+	end      int
+	step     int
+	hasStart bool
+	hasEnd   bool
+	filter   filterNode
+}
+
+// eval evaluates the query against the root of the input
+// a singular query, made of names and indexes only,
+// returns its value or MISSING if it selects nothing
+// any other query returns the selected values as an array
+func (q *jsonPath) eval(root any) any {
+	nodes := q.nodes(root, root)
+	if !q.singular() {
+		return append([]any{}, nodes...)
+	}
+	if len(nodes) == 0 {
+		return constMap[Missing]
+	}
+	return nodes[0]
+}
+
+// singular checks if the query selects at most one value
+func (q *jsonPath) singular() bool {
+	for _, seg := range q.segments {
+		if seg.descendant || len(seg.selectors) != 1 {
+			return false
+		}
+		if kind := seg.selectors[0].kind; kind != selectorName && kind != selectorIndex {
+			return false
+		}
+	}
+	return true
+}
+
+// nodes returns the values selected from start in document order
+// root is the value $ refers to inside filters
+func (q *jsonPath) nodes(start, root any) []any {
+	nodes := []any{start}
+	for _, seg := range q.segments {
+		var next []any
+		for _, n := range nodes {
+			if !seg.descendant {
+				next = seg.selectFrom(n, root, next)
+				continue
+			}
+			descend(n, func(v any) {
+				next = seg.selectFrom(v, root, next)
+			})
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// selectFrom appends the children of a node selected by the segment
+func (seg jsonPathSegment) selectFrom(val, root any, nodes []any) []any {
+	for _, sel := range seg.selectors {
+		nodes = sel.selectFrom(val, root, nodes)
+	}
+	return nodes
+}
+
+// selectFrom appends the children of a node selected by the selector
+func (sel jsonPathSelector) selectFrom(val, root any, nodes []any) []any {
+	switch sel.kind {
+	case selectorName:
+		if m, ok := val.(map[string]any); ok {
+			if v, ok := m[sel.name]; ok {
+				nodes = append(nodes, v)
+			}
+		}
+	case selectorWildcard:
+		nodes = append(nodes, children(val)...)
+	case selectorIndex:
+		elems, _ := toSlice(val)
+		i := sel.index
+		if i < 0 {
+			i += len(elems)
+		}
+		if i >= 0 && i < len(elems) {
+			nodes = append(nodes, elems[i])
+		}
+	case selectorSlice:
+		elems, _ := toSlice(val)
+		for _, i := range sel.sliceIndexes(len(elems)) {
+			nodes = append(nodes, elems[i])
+		}
+	case selectorFilter:
+		for _, child := range children(val) {
+			if filterTest(sel.filter.eval(root, child)) {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	return nodes
+}
+
+// sliceIndexes returns the indexes a slice selects
+// from an array of the given length
+func (sel jsonPathSelector) sliceIndexes(length int) []int {
+	if sel.step == 0 {
+		return nil
+	}
+	normalize := func(i int) int {
+		if i < 0 {
+			return i + length
+		}
+		return i
+	}
+	clamp := func(i, lower, upper int) int {
+		if i < lower {
+			return lower
+		}
+		if i > upper {
+			return upper
+		}
+		return i
+	}
+	var indexes []int
+	if sel.step > 0 {
+		start, end := 0, length
+		if sel.hasStart {
+			start = clamp(normalize(sel.start), 0, length)
+		}
+		if sel.hasEnd {
+			end = clamp(normalize(sel.end), 0, length)
+		}
+		for i := start; i < end; i += sel.step {
+			indexes = append(indexes, i)
+		}
+		return indexes
+	}
+	start, end := length-1, -1
+	if sel.hasStart {
+		start = clamp(normalize(sel.start), -1, length-1)
+	}
+	if sel.hasEnd {
+		end = clamp(normalize(sel.end), -1, length-1)
+	}
+	for i := start; i > end; i += sel.step {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// filterNode is a node of a JSONPath filter expression
+// it evaluates to a bool, a value, MISSING or a nodeList
+type filterNode interface {
+	eval(root, current any) any
+}
+
+// nodeList is the result of a query inside a filter
+type nodeList []any
+
+// filterLiteral is a number, string, true, false or null
+type filterLiteral struct {
+	val any
+}
+
+// eval returns the literal value
+func (n *filterLiteral) eval(any, any) any {
+	return n.val
+}
+
+// filterQuery is a query from the current node @
+// or from the root $ inside a filter
+type filterQuery struct {
+	relative bool
+	query    *jsonPath
+}
+
+// eval returns the values selected by the query
+func (n *filterQuery) eval(root, current any) any {
+	if n.relative {
+		return nodeList(n.query.nodes(current, root))
+	}
+	return nodeList(n.query.nodes(root, root))
+}
+
+// filterNot is a negated filter expression, e.g. !@.a
+type filterNot struct {
+	x filterNode
+}
+
+// eval negates the test of the expression
+func (n *filterNot) eval(root, current any) any {
+	return !filterTest(n.x.eval(root, current))
+}
+
+// filterLogical is && or || between two filter expressions
+type filterLogical struct {
+	or   bool
+	x, y filterNode
+}
+
+// eval tests both expressions
+// y is not evaluated if x decides the result
+func (n *filterLogical) eval(root, current any) any {
+	if filterTest(n.x.eval(root, current)) == n.or {
+		return n.or
+	}
+	return filterTest(n.y.eval(root, current))
+}
+
+// filterCompare is a comparison between two filter values
+type filterCompare struct {
+	op   string
+	x, y filterNode
+}
+
+// eval compares the values of both sides
+func (n *filterCompare) eval(root, current any) any {
+	x := filterValue(n.x.eval(root, current))
+	y := filterValue(n.y.eval(root, current))
+	switch n.op {
+	case "==":
+		return filterEqual(x, y)
+	case "!=":
+		return !filterEqual(x, y)
+	case "<":
+		return filterLess(x, y)
+	case "<=":
+		return filterLess(x, y) || filterEqual(x, y)
+	case ">":
+		return filterLess(y, x)
+	default:
+		return filterLess(y, x) || filterEqual(x, y)
+	}
+}
+
+// filterCall is a function call inside a filter, e.g. length(@.sku)
+type filterCall struct {
+	name string
+	args []filterNode
+}
+
+// filterFuncArgs is the number of arguments of the filter functions
+var filterFuncArgs = map[string]int{
+	"length": 1,
+	"count":  1,
+	"match":  2,
+	"search": 2,
+	"value":  1,
+}
+
+// eval calls the function
+// length returns the length of a string, an array or an object
+// count returns the number of values selected by a query
+// match checks if a string matches a regular expression entirely
+// search checks if a string contains a match of a regular expression
+// value returns the only value selected by a query
+func (n *filterCall) eval(root, current any) any {
+	args := make([]any, len(n.args))
+	for i, a := range n.args {
+		args[i] = a.eval(root, current)
+	}
+	switch n.name {
+	case "length":
+		switch v := filterValue(args[0]).(type) {
+		case string:
+			return utf8.RuneCountInString(v)
+		case map[string]any:
+			return len(v)
+		default:
+			if elems, ok := toSlice(v); ok {
+				return len(elems)
+			}
+			return constMap[Missing]
+		}
+	case "count":
+		nodes, _ := args[0].(nodeList)
+		return len(nodes)
+	case "match", "search":
+		str, ok := filterValue(args[0]).(string)
+		pattern, patternOk := filterValue(args[1]).(string)
+		if !ok || !patternOk {
+			return false
+		}
+		if n.name == "match" {
+			pattern = "^(?:" + pattern + ")$"
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false
+		}
+		return re.MatchString(str)
+	default:
+		return filterValue(args[0])
+	}
+}
+
+// filterTest checks if a filter expression is true
+// a query is true if it selects any value
+func filterTest(val any) bool {
+	switch val := val.(type) {
+	case nodeList:
+		return len(val) > 0
+	case bool:
+		return val
+	default:
+		return false
+	}
+}
+
+// filterValue returns the value of a filter expression
+// a query has a value only if it selects exactly one value
+func filterValue(val any) any {
+	nodes, ok := val.(nodeList)
+	if !ok {
+		return val
+	}
+	if len(nodes) != 1 {
+		return constMap[Missing]
+	}
+	return nodes[0]
+}
+
+// filterEqual checks if two filter values are equal
+// MISSING is only equal to MISSING
+func filterEqual(x, y any) bool {
+	if isMissing(x) || isMissing(y) {
+		return isMissing(x) && isMissing(y)
+	}
+	if isNumber(x) && isNumber(y) {
+		xNum, _ := toNumber(x)
+		yNum, _ := toNumber(y)
+		return xNum == yNum
+	}
+	switch x := x.(type) {
+	case map[string]any:
+		y, ok := y.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !filterEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case string, bool, nil:
+		return x == y
+	}
+	xElems, xOk := toSlice(x)
+	yElems, yOk := toSlice(y)
+	if !xOk || !yOk || len(xElems) != len(yElems) {
+		return false
+	}
+	for i := range xElems {
+		if !filterEqual(xElems[i], yElems[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// filterLess checks if x is less than y
+// only numbers and strings are ordered
+func filterLess(x, y any) bool {
+	if isNumber(x) && isNumber(y) {
+		xNum, _ := toNumber(x)
+		yNum, _ := toNumber(y)
+		return xNum < yNum
+	}
+	xStr, xOk := x.(string)
+	yStr, yOk := y.(string)
+	return xOk && yOk && xStr < yStr
+}
+
+// jsonPathParser parses a JSONPath query
+type jsonPathParser struct {
+	str    string
+	pos    int
+	offset int
+}
+
+// parseJSONPath parses a JSONPath query starting with $
+// offset is the byte offset of the query in the expression
+func parseJSONPath(str string, offset int) (*jsonPath, error) {
+	jp := jsonPathParser{str: str, offset: offset}
+	if !jp.consume("$") {
+		return nil, jp.errorf("expected $")
+	}
+	q, err := jp.segments()
+	if err != nil {
+		return nil, err
+	}
+	if jp.pos < len(jp.str) {
+		return nil, jp.errorf("unexpected %q", jp.str[jp.pos:])
+	}
+	return q, nil
+}
+
+// errorf creates an error at the current position
+func (jp *jsonPathParser) errorf(format string, a ...any) error {
+	return errorAt(jp.offset+jp.pos, "invalid JSONPath: %w", fmt.Errorf(format, a...))
+}
+
+// peek returns the current byte or 0 at the end
+func (jp *jsonPathParser) peek() byte {
+	if jp.pos >= len(jp.str) {
+		return 0
+	}
+	return jp.str[jp.pos]
+}
+
+// consume advances over s if the query continues with it
+func (jp *jsonPathParser) consume(s string) bool {
+	if !strings.HasPrefix(jp.str[jp.pos:], s) {
+		return false
+	}
+	jp.pos += len(s)
+	return true
+}
+
+// skipSpace skips the blank space allowed between tokens
+func (jp *jsonPathParser) skipSpace() {
+	for jp.pos < len(jp.str) && strings.IndexByte(" \t\n\r", jp.str[jp.pos]) >= 0 {
+		jp.pos++
+	}
+}
+
+// segments parses the segments of a query after $ or @
+func (jp *jsonPathParser) segments() (*jsonPath, error) {
+	var q jsonPath
+	for {
+		var seg jsonPathSegment
+		var err error
+		switch {
+		case jp.consume(".."):
+			seg.descendant = true
+			if jp.peek() == '[' {
+				seg.selectors, err = jp.bracket()
+			} else {
+				seg.selectors, err = jp.dotSelector()
+			}
+		case jp.consume("."):
+			seg.selectors, err = jp.dotSelector()
+		case jp.peek() == '[':
+			seg.selectors, err = jp.bracket()
+		default:
+			return &q, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		q.segments = append(q.segments, seg)
+	}
+}
+
+// dotSelector parses the name or the wildcard after a dot
+func (jp *jsonPathParser) dotSelector() ([]jsonPathSelector, error) {
+	if jp.consume(string(Wildcard)) {
+		return []jsonPathSelector{{kind: selectorWildcard}}, nil
+	}
+	start := jp.pos
+	for jp.pos < len(jp.str) {
+		r, size := utf8.DecodeRuneInString(jp.str[jp.pos:])
+		if !isNameChar(r) || (jp.pos == start && unicode.IsDigit(r)) {
+			break
+		}
+		jp.pos += size
+	}
+	if jp.pos == start {
+		return nil, jp.errorf("expected member name")
+	}
+	return []jsonPathSelector{{kind: selectorName, name: jp.str[start:jp.pos]}}, nil
+}
+
+// isNameChar checks if a rune can be part of a member name after a dot
+func isNameChar(r rune) bool {
+	return r == '_' || r >= utf8.RuneSelf || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// bracket parses the comma separated selectors between square brackets
+func (jp *jsonPathParser) bracket() ([]jsonPathSelector, error) {
+	jp.pos++
+	var selectors []jsonPathSelector
+	for {
+		jp.skipSpace()
+		sel, err := jp.selector()
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, sel)
+		jp.skipSpace()
+		switch {
+		case jp.consume(string(Comma)):
+		case jp.consume(string(RightSquareBracket)):
+			return selectors, nil
+		default:
+			return nil, jp.errorf("expected %s or %s", Comma, RightSquareBracket)
+		}
+	}
+}
+
+// selector parses a selector between square brackets
+func (jp *jsonPathParser) selector() (jsonPathSelector, error) {
+	switch c := jp.peek(); {
+	case c == '\'' || c == '"':
+		name, err := jp.readString()
+		if err != nil {
+			return jsonPathSelector{}, err
+		}
+		return jsonPathSelector{kind: selectorName, name: name}, nil
+	case jp.consume(string(Wildcard)):
+		return jsonPathSelector{kind: selectorWildcard}, nil
+	case jp.consume("?"):
+		jp.skipSpace()
+		filter, err := jp.logicalOr()
+		if err != nil {
+			return jsonPathSelector{}, err
+		}
+		return jsonPathSelector{kind: selectorFilter, filter: filter}, nil
+	}
+	sel := jsonPathSelector{kind: selectorIndex, step: 1}
+	var err error
+	if sel.start, sel.hasStart, err = jp.readInt(); err != nil {
+		return jsonPathSelector{}, err
+	}
+	jp.skipSpace()
+	if !jp.consume(string(Colon)) {
+		if !sel.hasStart {
+			return jsonPathSelector{}, jp.errorf("expected selector")
+		}
+		sel.index = sel.start
+		return sel, nil
+	}
+	sel.kind = selectorSlice
+	jp.skipSpace()
+	if sel.end, sel.hasEnd, err = jp.readInt(); err != nil {
+		return jsonPathSelector{}, err
+	}
+	jp.skipSpace()
+	if jp.consume(string(Colon)) {
+		jp.skipSpace()
+		step, hasStep, err := jp.readInt()
+		if err != nil {
+			return jsonPathSelector{}, err
+		}
+		if hasStep {
+			sel.step = step
+		}
+	}
+	return sel, nil
+}
+
+// readInt reads an optional integer
+func (jp *jsonPathParser) readInt() (int, bool, error) {
+	start := jp.pos
+	jp.consume("-")
+	for jp.pos < len(jp.str) && isDigit(jp.str[jp.pos]) {
+		jp.pos++
+	}
+	if jp.pos == start {
+		return 0, false, nil
+	}
+	str := jp.str[start:jp.pos]
+	i, err := strconv.Atoi(str)
+	if err != nil {
+		jp.pos = start
+		return 0, false, jp.errorf("invalid integer %s", str)
+	}
+	return i, true, nil
+}
+
+// readString reads a string between apostrophes or quotation marks
+// with the escapes of JSON strings
+func (jp *jsonPathParser) readString() (string, error) {
+	start := jp.pos
+	quote := jp.str[jp.pos]
+	jp.pos++
+	var b strings.Builder
+	for jp.pos < len(jp.str) {
+		c := jp.str[jp.pos]
+		if c == quote {
+			jp.pos++
+			return b.String(), nil
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			jp.pos++
+			continue
+		}
+		jp.pos++
+		esc := jp.peek()
+		jp.pos++
+		switch esc {
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '/', '\\', '\'', '"':
+			b.WriteByte(esc)
+		case 'u':
+			r, err := jp.readHex()
+			if err != nil {
+				return "", err
+			}
+			if utf16.IsSurrogate(r) {
+				if !jp.consume(`\u`) {
+					return "", jp.errorf("expected low surrogate")
+				}
+				low, err := jp.readHex()
+				if err != nil {
+					return "", err
+				}
+				r = utf16.DecodeRune(r, low)
+			}
+			b.WriteRune(r)
+		default:
+			jp.pos--
+			return "", jp.errorf("invalid escape %q", esc)
+		}
+	}
+	jp.pos = start
+	return "", jp.errorf("unterminated string")
+}
+
+// readHex reads the 4 hexadecimal digits of a \u escape
+func (jp *jsonPathParser) readHex() (rune, error) {
+	if jp.pos+4 > len(jp.str) {
+		return 0, jp.errorf("invalid unicode escape")
+	}
+	r, err := strconv.ParseUint(jp.str[jp.pos:jp.pos+4], 16, 32)
+	if err != nil {
+		return 0, jp.errorf("invalid unicode escape")
+	}
+	jp.pos += 4
+	return rune(r), nil
+}
+
+// logicalOr parses filter expressions separated by ||
+func (jp *jsonPathParser) logicalOr() (filterNode, error) {
+	x, err := jp.logicalAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		jp.skipSpace()
+		if !jp.consume("||") {
+			return x, nil
+		}
+		y, err := jp.logicalAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &filterLogical{or: true, x: x, y: y}
+	}
+}
+
+// logicalAnd parses filter expressions separated by &&
+func (jp *jsonPathParser) logicalAnd() (filterNode, error) {
+	x, err := jp.basic()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		jp.skipSpace()
+		if !jp.consume("&&") {
+			return x, nil
+		}
+		y, err := jp.basic()
+		if err != nil {
+			return nil, err
+		}
+		x = &filterLogical{x: x, y: y}
+	}
+}
+
+// basic parses a parenthesized expression, a negation,
+// a comparison or a test of a query or a function
+func (jp *jsonPathParser) basic() (filterNode, error) {
+	jp.skipSpace()
+	if jp.consume("!") {
+		jp.skipSpace()
+		x, err := jp.test()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{x: x}, nil
+	}
+	if jp.peek() == '(' {
+		return jp.test()
+	}
+	start := jp.pos
+	x, err := jp.comparable()
+	if err != nil {
+		return nil, err
+	}
+	jp.skipSpace()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if jp.consume(op) {
+			jp.skipSpace()
+			y, err := jp.comparable()
+			if err != nil {
+				return nil, err
+			}
+			return &filterCompare{op: op, x: x, y: y}, nil
+		}
+	}
+	if _, ok := x.(*filterLiteral); ok {
+		jp.pos = start
+		return nil, jp.errorf("expected comparison")
+	}
+	return x, nil
+}
+
+// test parses a parenthesized expression,
+// a query or a function that can be negated
+func (jp *jsonPathParser) test() (filterNode, error) {
+	if !jp.consume("(") {
+		start := jp.pos
+		x, err := jp.comparable()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := x.(*filterLiteral); ok {
+			jp.pos = start
+			return nil, jp.errorf("expected query or function")
+		}
+		return x, nil
+	}
+	x, err := jp.logicalOr()
+	if err != nil {
+		return nil, err
+	}
+	jp.skipSpace()
+	if !jp.consume(")") {
+		return nil, jp.errorf("expected )")
+	}
+	return x, nil
+}
+
+// comparable parses a literal, a query or a function call
+func (jp *jsonPathParser) comparable() (filterNode, error) {
+	switch c := jp.peek(); {
+	case c == '@' || c == '$':
+		jp.pos++
+		q, err := jp.segments()
+		if err != nil {
+			return nil, err
+		}
+		return &filterQuery{relative: c == '@', query: q}, nil
+	case c == '\'' || c == '"':
+		str, err := jp.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &filterLiteral{val: str}, nil
+	case c == '-' || isDigit(c):
+		return jp.number()
+	}
+	start := jp.pos
+	for jp.pos < len(jp.str) && (jp.str[jp.pos] == '_' || unicode.IsLower(rune(jp.str[jp.pos])) || isDigit(jp.str[jp.pos])) {
+		jp.pos++
+	}
+	name := jp.str[start:jp.pos]
+	if jp.peek() == '(' {
+		return jp.call(name, start)
+	}
+	switch name {
+	case "true":
+		return &filterLiteral{val: true}, nil
+	case "false":
+		return &filterLiteral{val: false}, nil
+	case "null":
+		return &filterLiteral{val: nil}, nil
+	}
+	jp.pos = start
+	return nil, jp.errorf("expected value")
+}
+
+// number parses a number literal
+func (jp *jsonPathParser) number() (filterNode, error) {
+	start := jp.pos
+	jp.consume("-")
+	isInt := true
+	for jp.pos < len(jp.str) {
+		c := jp.str[jp.pos]
+		switch {
+		case isDigit(c):
+		case c == '.' || c == 'e' || c == 'E':
+			isInt = false
+		case (c == '+' || c == '-') && (jp.str[jp.pos-1] == 'e' || jp.str[jp.pos-1] == 'E'):
+		default:
+			return jp.numberLiteral(start, isInt)
+		}
+		jp.pos++
+	}
+	return jp.numberLiteral(start, isInt)
+}
+
+// numberLiteral converts the number read from start
+func (jp *jsonPathParser) numberLiteral(start int, isInt bool) (filterNode, error) {
+	str := jp.str[start:jp.pos]
+	if isInt {
+		if i, err := strconv.ParseInt(str, 10, 64); err == nil {
+			return &filterLiteral{val: i}, nil
+		}
+	}
+	f, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		jp.pos = start
+		return nil, jp.errorf("invalid number %s", str)
+	}
+	return &filterLiteral{val: f}, nil
+}
+
+// call parses the arguments of a filter function
+func (jp *jsonPathParser) call(name string, start int) (filterNode, error) {
+	nArgs, ok := filterFuncArgs[name]
+	if !ok {
+		jp.pos = start
+		return nil, jp.errorf("unknown function %s", name)
+	}
+	jp.pos++
+	var args []filterNode
+	for {
+		jp.skipSpace()
+		if len(args) == 0 && jp.consume(")") {
+			break
+		}
+		arg, err := jp.comparable()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		jp.skipSpace()
+		if jp.consume(")") {
+			break
+		}
+		if !jp.consume(string(Comma)) {
+			return nil, jp.errorf("expected %s or )", Comma)
+		}
+	}
+	if len(args) != nArgs {
+		jp.pos = start
+		return nil, jp.errorf("function %s: invalid number of arguments: %d", name, len(args))
+	}
+	if name == "count" || name == "value" {
+		if _, ok := args[0].(*filterQuery); !ok {
+			jp.pos = start
+			return nil, jp.errorf("function %s: expected query", name)
+		}
+	}
+	return &filterCall{name: name, args: args}, nil
+}
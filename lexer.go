@@ -0,0 +1,343 @@
+package json2json
+
+import (
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenKey
+	tokenJSONPath
+	tokenIdent
+	tokenOp
+	tokenLeftBracket
+	tokenRightBracket
+	tokenComma
+	tokenArrow
+)
+
+// token is a lexical token of an expression
+type token struct {
+	kind tokenKind
+	val  string
+	pos  int
+}
+
+// String returns the token as it is written in the expression
+func (t token) String() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return string(Apostrophe) + t.val + string(Apostrophe)
+	case tokenKey:
+		return string(LeftSquareBracket) + t.val + string(RightSquareBracket)
+	default:
+		return t.val
+	}
+}
+
+// operators is the list of all operators,
+// longer operators first so that <> is not read as <
+var operators = func() []string {
+	ops := make([]string, 0, len(opFunc)+len(unaryOpFunc))
+	for op := range opFunc {
+		ops = append(ops, string(op))
+	}
+	for op := range unaryOpFunc {
+		if _, ok := opFunc[op]; !ok {
+			ops = append(ops, string(op))
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		if len(ops[i]) != len(ops[j]) {
+			return len(ops[i]) > len(ops[j])
+		}
+		return ops[i] < ops[j]
+	})
+	return ops
+}()
+
+// lexer splits an expression into tokens
+type lexer struct {
+	str    string
+	pos    int
+	tokens []token
+}
+
+// lex splits an expression into tokens
+// whitespace is skipped except inside strings and keys
+func lex(str string) ([]token, error) {
+	l := lexer{str: str}
+	for {
+		l.skipWhitespace()
+		if l.pos >= len(l.str) {
+			l.tokens = append(l.tokens, token{kind: tokenEOF, pos: l.pos})
+			return l.tokens, nil
+		}
+		if err := l.next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipWhitespace skips whitespace
+func (l *lexer) skipWhitespace() {
+	for l.pos < len(l.str) {
+		r, size := utf8.DecodeRuneInString(l.str[l.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		l.pos += size
+	}
+}
+
+// emit adds a token that starts at pos
+func (l *lexer) emit(kind tokenKind, val string, pos int) {
+	l.tokens = append(l.tokens, token{kind: kind, val: val, pos: pos})
+}
+
+// next reads the next token
+func (l *lexer) next() error {
+	start := l.pos
+	r, size := utf8.DecodeRuneInString(l.str[l.pos:])
+	switch ParserChar(r) {
+	case LeftBracket:
+		l.pos += size
+		l.emit(tokenLeftBracket, string(r), start)
+		return nil
+	case RightBracket:
+		l.pos += size
+		l.emit(tokenRightBracket, string(r), start)
+		return nil
+	case Comma:
+		l.pos += size
+		l.emit(tokenComma, string(r), start)
+		return nil
+	case Apostrophe:
+		return l.lexString()
+	case LeftSquareBracket:
+		return l.lexKey()
+	case Dollar:
+		return l.lexJSONPath()
+	}
+	switch {
+	case r < utf8.RuneSelf && isDigit(byte(r)):
+		l.lexNumber()
+		return nil
+	case r == '_' || unicode.IsLetter(r):
+		l.lexIdent()
+		return nil
+	}
+	if len(l.str)-l.pos >= len(Arrow) && ParserChar(l.str[l.pos:l.pos+len(Arrow)]) == Arrow {
+		l.pos += len(Arrow)
+		l.emit(tokenArrow, string(Arrow), start)
+		return nil
+	}
+	for _, op := range operators {
+		if len(l.str)-l.pos >= len(op) && l.str[l.pos:l.pos+len(op)] == op {
+			l.pos += len(op)
+			l.emit(tokenOp, op, start)
+			return nil
+		}
+	}
+	return errorAt(start, "unexpected character %q", r)
+}
+
+// lexString reads a string between two apostrophes
+func (l *lexer) lexString() error {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.str) {
+		if ParserChar(l.str[l.pos]) == Apostrophe {
+			l.emit(tokenString, l.str[start+1:l.pos], start)
+			l.pos++
+			return nil
+		}
+		l.pos++
+	}
+	return errorAt(start, "unterminated string")
+}
+
+// lexKey reads an input key between square brackets
+// nested square brackets, quoted fields and escaped characters
+// are kept in the key
+// an apostrophe starts a quoted field only at the start of a field,
+// so [o'b] is the field o'b
+// a JSON Pointer has no quoted fields nor escaped characters
+func (l *lexer) lexKey() error {
+	start := l.pos
+	depth := 0
+	quoted := false
+	fieldStart := false
+	pointer := l.pos+1 < len(l.str) && ParserChar(l.str[l.pos+1]) == Slash
+	for l.pos < len(l.str) {
+		if pointer && ParserChar(l.str[l.pos]) == Apostrophe {
+			l.pos++
+			continue
+		}
+		if !pointer && l.str[l.pos] == '\\' {
+			l.pos += 2
+			fieldStart = false
+			continue
+		}
+		c := ParserChar(l.str[l.pos])
+		switch c {
+		case Apostrophe:
+			if quoted {
+				quoted = false
+			} else if fieldStart {
+				quoted = true
+			}
+		case LeftSquareBracket:
+			if !quoted {
+				depth++
+			}
+		case RightSquareBracket:
+			if !quoted {
+				depth--
+			}
+		}
+		fieldStart = !quoted && (c == LeftSquareBracket || c == Dot)
+		l.pos++
+		if depth == 0 {
+			l.emit(tokenKey, l.str[start+1:l.pos-1], start)
+			return nil
+		}
+	}
+	return errorAt(start, "unterminated key")
+}
+
+// lexJSONPath reads a JSONPath query starting with $
+// the query ends before the first character
+// that does not continue it with a dot or square brackets
+// e.g. $.packages[?@.quantity > 1].sku
+func (l *lexer) lexJSONPath() error {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.str) {
+		switch ParserChar(l.str[l.pos]) {
+		case Dot:
+			l.pos++
+			if l.pos < len(l.str) && ParserChar(l.str[l.pos]) == Dot {
+				l.pos++
+			}
+			if l.pos < len(l.str) && ParserChar(l.str[l.pos]) == Wildcard {
+				l.pos++
+				continue
+			}
+			for l.pos < len(l.str) {
+				r, size := utf8.DecodeRuneInString(l.str[l.pos:])
+				if !isNameChar(r) {
+					break
+				}
+				l.pos += size
+			}
+		case LeftSquareBracket:
+			if err := l.skipBrackets(start); err != nil {
+				return err
+			}
+		default:
+			l.emit(tokenJSONPath, l.str[start:l.pos], start)
+			return nil
+		}
+	}
+	l.emit(tokenJSONPath, l.str[start:l.pos], start)
+	return nil
+}
+
+// skipBrackets skips square brackets with everything inside them
+// strings between apostrophes or quotation marks can contain brackets
+func (l *lexer) skipBrackets(start int) error {
+	depth := 0
+	var quote byte
+	for l.pos < len(l.str) {
+		c := l.str[l.pos]
+		switch {
+		case quote != 0 && c == '\\':
+			l.pos++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+		case c == '\'' || c == '"':
+			quote = c
+		case ParserChar(c) == LeftSquareBracket:
+			depth++
+		case ParserChar(c) == RightSquareBracket:
+			depth--
+		}
+		l.pos++
+		if depth == 0 {
+			return nil
+		}
+	}
+	return errorAt(start, "unterminated JSONPath")
+}
+
+// lexNumber reads an integer or a decimal number
+// with an optional exponent
+func (l *lexer) lexNumber() {
+	start := l.pos
+	l.digits()
+	if l.pos < len(l.str) && ParserChar(l.str[l.pos]) == Dot {
+		l.pos++
+		l.digits()
+	}
+	if l.pos < len(l.str) && (l.str[l.pos] == 'e' || l.str[l.pos] == 'E') {
+		end := l.pos
+		l.pos++
+		if l.pos < len(l.str) && (l.str[l.pos] == '+' || l.str[l.pos] == '-') {
+			l.pos++
+		}
+		if l.pos >= len(l.str) || !isDigit(l.str[l.pos]) {
+			l.pos = end
+		}
+		l.digits()
+	}
+	l.emit(tokenNumber, l.str[start:l.pos], start)
+}
+
+// digits reads a sequence of digits
+func (l *lexer) digits() {
+	for l.pos < len(l.str) && isDigit(l.str[l.pos]) {
+		l.pos++
+	}
+}
+
+// lexIdent reads a function or constant name
+// or a lambda parameter with the fields it looks up like x.item.weight
+func (l *lexer) lexIdent() {
+	start := l.pos
+	for l.pos < len(l.str) {
+		r, size := utf8.DecodeRuneInString(l.str[l.pos:])
+		if ParserChar(r) == Dot && l.pos+size < len(l.str) {
+			next, _ := utf8.DecodeRuneInString(l.str[l.pos+size:])
+			if isIdentChar(next) {
+				l.pos += size
+				continue
+			}
+		}
+		if !isIdentChar(r) {
+			break
+		}
+		l.pos += size
+	}
+	l.emit(tokenIdent, l.str[start:l.pos], start)
+}
+
+// isIdentChar checks if a rune can be part of a name
+func isIdentChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isDigit checks if a byte is an ASCII digit
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
@@ -0,0 +1,386 @@
+package json2json
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cast"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// toInt64 converts an integer to int64
+// it returns false for floats, non-integer json.Numbers
+// and anything that is not a number
+func toInt64(x any) (int64, bool) {
+	switch x := x.(type) {
+	case int:
+		return int64(x), true
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case uint:
+		return int64(x), uint64(x) <= math.MaxInt64
+	case uint8:
+		return int64(x), true
+	case uint16:
+		return int64(x), true
+	case uint32:
+		return int64(x), true
+	case uint64:
+		return int64(x), x <= math.MaxInt64
+	case json.Number:
+		i, err := x.Int64()
+		return i, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// unwrapNumber converts a json.Number to the int64 or float64 it holds
+// so that the cast functions treat it as a number
+// instead of the string it holds, e.g. a cast to an integer
+// truncates 2.5 to 2 instead of failing on the string "2.5"
+func unwrapNumber(x any) any {
+	num, ok := x.(json.Number)
+	if !ok {
+		return x
+	}
+	if i, ok := toInt64(num); ok {
+		return i
+	}
+	if f, err := num.Float64(); err == nil {
+		return f
+	}
+	return x
+}
+
+// toStringE converts a value to string like cast.ToStringE
+// a json.Number is written in its shortest decimal form,
+// so FLOAT(2, 1) is "2" like the number it stands for
+func toStringE(x any) (string, error) {
+	num, ok := x.(json.Number)
+	if !ok {
+		return cast.ToStringE(x)
+	}
+	r, err := toRat(num)
+	if err != nil {
+		return cast.ToStringE(x)
+	}
+	if r.IsInt() {
+		return r.Num().String(), nil
+	}
+	digits, _ := decimalDigits(r.Denom())
+	return r.FloatString(digits), nil
+}
+
+// arith applies an arithmetic operator to two values
+// two integers give an integer, anything else gives a float
+// an integer result that overflows int64 is an error
+// and so is an operand that is not a number
+func arith(x, y any, intOp func(a, b int64) (int64, error), floatOp func(a, b float64) float64) (any, error) {
+	if a, ok := toInt64(x); ok {
+		if b, ok := toInt64(y); ok {
+			return intOp(a, b)
+		}
+	}
+	a, b, err := toFloat64s(x, y)
+	if err != nil {
+		return nil, err
+	}
+	return floatOp(a, b), nil
+}
+
+// toFloat64s converts the operands of an operator to float64
+func toFloat64s(x, y any) (float64, float64, error) {
+	a, err := cast.ToFloat64E(x)
+	if err != nil {
+		return 0, 0, err
+	}
+	b, err := cast.ToFloat64E(y)
+	if err != nil {
+		return 0, 0, err
+	}
+	return a, b, nil
+}
+
+// NonFinite is what a NaN or infinite number evaluates to
+type NonFinite int
+
+const (
+	// NonFiniteError fails the evaluation
+	NonFiniteError NonFinite = iota
+	// NonFiniteNull evaluates to null
+	NonFiniteNull
+	// NonFiniteString evaluates to the string NaN, +Inf or -Inf
+	NonFiniteString
+)
+
+// isZero checks if a value is zero as a divisor
+// a value that is not a number is not zero,
+// the division reports it instead
+func isZero(x any) bool {
+	if r, err := toRat(x); err == nil {
+		return r.Sign() == 0
+	}
+	f, err := cast.ToFloat64E(x)
+	return err == nil && f == 0
+}
+
+// errOverflow is the error of an integer result that overflows int64
+var errOverflow = fmt.Errorf("integer overflow")
+
+// errDivByZero is the error of a division by zero
+var errDivByZero = fmt.Errorf("division by zero")
+
+// addInt64 adds two integers
+func addInt64(a, b int64) (int64, error) {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return 0, errOverflow
+	}
+	return c, nil
+}
+
+// subInt64 subtracts two integers
+func subInt64(a, b int64) (int64, error) {
+	c := a - b
+	if (c < a) != (b > 0) {
+		return 0, errOverflow
+	}
+	return c, nil
+}
+
+// mulInt64 multiplies two integers
+func mulInt64(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+	c := a * b
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, errOverflow
+	}
+	return c, nil
+}
+
+// quoInt64 divides two integers truncating toward zero
+func quoInt64(a, b int64) (int64, error) {
+	if b == 0 {
+		return 0, errDivByZero
+	}
+	if a == math.MinInt64 && b == -1 {
+		return 0, errOverflow
+	}
+	return a / b, nil
+}
+
+// remInt64 returns the remainder of the division of two integers
+// with the sign of a, so a = (a // b) * b + a % b
+func remInt64(a, b int64) (int64, error) {
+	if b == 0 {
+		return 0, errDivByZero
+	}
+	return a % b, nil
+}
+
+// negInt64 negates an integer
+func negInt64(a int64) (int64, error) {
+	if a == math.MinInt64 {
+		return 0, errOverflow
+	}
+	return -a, nil
+}
+
+// toRat converts a number or a numeric string to an exact rational
+// a float is converted from its shortest decimal form,
+// so 0.1 is exactly 1/10
+func toRat(x any) (*big.Rat, error) {
+	switch v := x.(type) {
+	case json.Number:
+		return parseRat(string(v))
+	case string:
+		return parseRat(v)
+	case float32:
+		return floatToRat(float64(v), 32)
+	case float64:
+		return floatToRat(v, 64)
+	}
+	if i, ok := toInt64(x); ok {
+		return new(big.Rat).SetInt64(i), nil
+	}
+	f, err := cast.ToFloat64E(x)
+	if err != nil {
+		return nil, err
+	}
+	return floatToRat(f, 64)
+}
+
+// parseRat parses a decimal number with an optional exponent
+func parseRat(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", s)
+	}
+	return r, nil
+}
+
+// floatToRat converts a float with the given bit size
+// from its shortest decimal form
+func floatToRat(f float64, bitSize int) (*big.Rat, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("invalid number %v", f)
+	}
+	return parseRat(strconv.FormatFloat(f, 'g', -1, bitSize))
+}
+
+// ratToNumber formats a rational as a decimal number
+// it is exact if the decimal form has at most scale digits
+// after the decimal point, otherwise it is rounded to scale digits
+func ratToNumber(r *big.Rat, scale int) json.Number {
+	if r.IsInt() {
+		return json.Number(r.Num().String())
+	}
+	if digits, ok := decimalDigits(r.Denom()); ok && digits <= scale {
+		return json.Number(r.FloatString(digits))
+	}
+	s := r.FloatString(scale)
+	if strings.Contains(s, string(Dot)) {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), string(Dot))
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return json.Number(s)
+}
+
+// decimalDigits returns the number of digits after the decimal point
+// of a fraction with the given denominator
+// it returns false if the decimal form does not terminate
+func decimalDigits(denom *big.Int) (int, bool) {
+	d := new(big.Int).Set(denom)
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for {
+		q, m := new(big.Int).QuoRem(d, two, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		d, twos = q, twos+1
+	}
+	for {
+		q, m := new(big.Int).QuoRem(d, five, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		d, fives = q, fives+1
+	}
+	if d.Cmp(big.NewInt(1)) != 0 {
+		return 0, false
+	}
+	if twos > fives {
+		return twos, true
+	}
+	return fives, true
+}
+
+// DefaultDecimalScale is the number of digits after the decimal point
+// a division without a finite decimal form is rounded to
+// in decimal mode
+const DefaultDecimalScale = 16
+
+// decimalOpFunc is a map that contains the arithmetic operator functions
+// of the decimal mode, they compute with exact rationals
+// and return json.Number
+var decimalOpFunc = map[Operator]func(x, y any, scale int) (any, error){
+	Mul:    decimalOp((*big.Rat).Mul),
+	Div:    decimalDivFunc,
+	IntDiv: decimalIntDivFunc,
+	Modulo: decimalModuloFunc,
+	Add:    decimalOp((*big.Rat).Add),
+	Sub:    decimalOp((*big.Rat).Sub),
+}
+
+// decimalOp creates a decimal operator function
+// from a big.Rat method like (*big.Rat).Add
+func decimalOp(op func(z, x, y *big.Rat) *big.Rat) func(x, y any, scale int) (any, error) {
+	return func(x, y any, scale int) (any, error) {
+		a, err := toRat(x)
+		if err != nil {
+			return nil, err
+		}
+		b, err := toRat(y)
+		if err != nil {
+			return nil, err
+		}
+		return ratToNumber(op(new(big.Rat), a, b), scale), nil
+	}
+}
+
+// decimalDivFunc divides two values exactly
+// a quotient without a finite decimal form is rounded to scale digits
+func decimalDivFunc(x, y any, scale int) (any, error) {
+	a, b, err := decimalDivisor(x, y)
+	if err != nil {
+		return nil, err
+	}
+	return ratToNumber(new(big.Rat).Quo(a, b), scale), nil
+}
+
+// decimalIntDivFunc divides two values exactly
+// and truncates the quotient toward zero
+func decimalIntDivFunc(x, y any, scale int) (any, error) {
+	a, b, err := decimalDivisor(x, y)
+	if err != nil {
+		return nil, err
+	}
+	return ratToNumber(truncRat(new(big.Rat).Quo(a, b)), scale), nil
+}
+
+// decimalModuloFunc returns the exact remainder of the division
+// of two values with the sign of x
+func decimalModuloFunc(x, y any, scale int) (any, error) {
+	a, b, err := decimalDivisor(x, y)
+	if err != nil {
+		return nil, err
+	}
+	q := truncRat(new(big.Rat).Quo(a, b))
+	return ratToNumber(q.Sub(a, q.Mul(q, b)), scale), nil
+}
+
+// decimalDivisor converts the operands of a division to rationals
+// it returns an error if the divisor is zero
+func decimalDivisor(x, y any) (*big.Rat, *big.Rat, error) {
+	a, err := toRat(x)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := toRat(y)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.Sign() == 0 {
+		return nil, nil, errDivByZero
+	}
+	return a, b, nil
+}
+
+// truncRat truncates a rational toward zero
+func truncRat(r *big.Rat) *big.Rat {
+	return r.SetInt(new(big.Int).Quo(r.Num(), r.Denom()))
+}
+
+// decimalNegFunc negates a value exactly
+func decimalNegFunc(x any, scale int) (any, error) {
+	a, err := toRat(x)
+	if err != nil {
+		return nil, err
+	}
+	return ratToNumber(a.Neg(a), scale), nil
+}
@@ -1,69 +1,234 @@
 package json2json
 
 import (
+	"encoding/json"
 	"github.com/spf13/cast"
+	"math"
 	"reflect"
-	"strings"
+	"strconv"
 )
 
 // Operator is an operator
 type Operator string
 
 const (
-	Eq    Operator = "="
-	NotEq Operator = "<>"
-	Mul   Operator = "*"
-	Div   Operator = "/"
-	Add   Operator = "+"
-	Sub   Operator = "-"
+	Eq        Operator = "="
+	NotEq     Operator = "<>"
+	Less      Operator = "<"
+	LessEq    Operator = "<="
+	Greater   Operator = ">"
+	GreaterEq Operator = ">="
+	LogicAnd  Operator = "&&"
+	LogicOr   Operator = "||"
+	LogicNot  Operator = "!"
+	Mul       Operator = "*"
+	Div       Operator = "/"
+	IntDiv    Operator = "//"
+	Modulo    Operator = "%"
+	Add       Operator = "+"
+	Sub       Operator = "-"
 )
 
 // opFunc is a map that contains all operator functions
-var opFunc = map[Operator]func(x, y any) any{
-	Eq:    eqFunc,
-	NotEq: notEqFunc,
-	Mul:   mulFunc,
-	Div:   divFunc,
-	Add:   addFunc,
-	Sub:   subFunc,
-}
-
-// containsOp checks if a string contains an operator
-func containsOp(str string) (Operator, bool) {
-	for op := range opFunc {
-		if strings.Contains(str, string(op)) {
-			return op, true
-		}
-	}
-	return "", false
+var opFunc = map[Operator]func(x, y any) (any, error){
+	Eq:        eqFunc,
+	NotEq:     notEqFunc,
+	Less:      lessFunc,
+	LessEq:    lessEqFunc,
+	Greater:   greaterFunc,
+	GreaterEq: greaterEqFunc,
+	LogicAnd:  logicAndFunc,
+	LogicOr:   logicOrFunc,
+	Mul:       mulFunc,
+	Div:       divFunc,
+	IntDiv:    intDivFunc,
+	Modulo:    moduloFunc,
+	Add:       addFunc,
+	Sub:       subFunc,
+}
+
+// unaryOpFunc is a map that contains all prefix operator functions
+var unaryOpFunc = map[Operator]func(x any) (any, error){
+	LogicNot: logicNotFunc,
+	Sub:      negFunc,
+}
+
+// opPrecedence is the precedence of each operator,
+// an operator with a higher precedence binds tighter
+var opPrecedence = map[Operator]int{
+	LogicOr:   1,
+	LogicAnd:  2,
+	Eq:        3,
+	NotEq:     3,
+	Less:      3,
+	LessEq:    3,
+	Greater:   3,
+	GreaterEq: 3,
+	Add:       4,
+	Sub:       4,
+	Mul:       5,
+	Div:       5,
+	IntDiv:    5,
+	Modulo:    5,
 }
 
 // eqFunc checks if two values are equal
-func eqFunc(x, y any) any {
-	return reflect.DeepEqual(x, y)
+func eqFunc(x, y any) (any, error) {
+	return equal(x, y), nil
 }
 
 // notEqFunc checks if two values are not equal
-func notEqFunc(x, y any) any {
-	return !reflect.DeepEqual(x, y)
+func notEqFunc(x, y any) (any, error) {
+	return !equal(x, y), nil
+}
+
+// lessFunc checks if x < y like LT(x, y)
+func lessFunc(x, y any) (any, error) {
+	return ltFunc([]any{x, y})
+}
+
+// lessEqFunc checks if x <= y like LTE(x, y)
+func lessEqFunc(x, y any) (any, error) {
+	return lteFunc([]any{x, y})
+}
+
+// greaterFunc checks if x > y like GT(x, y)
+func greaterFunc(x, y any) (any, error) {
+	return gtFunc([]any{x, y})
+}
+
+// greaterEqFunc checks if x >= y like GTE(x, y)
+func greaterEqFunc(x, y any) (any, error) {
+	return gteFunc([]any{x, y})
+}
+
+// logicAndFunc checks if x && y like AND(x, y)
+func logicAndFunc(x, y any) (any, error) {
+	return andFunc(lazyValues(x, y))
+}
+
+// logicOrFunc checks if x || y like OR(x, y)
+func logicOrFunc(x, y any) (any, error) {
+	return orFunc(lazyValues(x, y))
+}
+
+// logicNotFunc negates a bool
+func logicNotFunc(x any) (any, error) {
+	b, err := cast.ToBoolE(unwrapNumber(x))
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+// negFunc negates a number
+// an integer stays an integer
+func negFunc(x any) (any, error) {
+	if i, ok := toInt64(x); ok {
+		return negInt64(i)
+	}
+	num, err := cast.ToFloat64E(x)
+	if err != nil {
+		return nil, err
+	}
+	return -num, nil
+}
+
+// equal checks if two values are equal
+// a number is compared by value with another number
+// or a numeric string, so '1' = 1 and 2.0 = 2
+func equal(x, y any) bool {
+	if xInt, ok := toInt64(x); ok {
+		if yInt, ok := toInt64(y); ok {
+			return xInt == yInt
+		}
+	}
+	if isNumber(x) || isNumber(y) {
+		xNum, xOk := toNumber(x)
+		yNum, yOk := toNumber(y)
+		if xOk && yOk {
+			return xNum == yNum
+		}
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// isNumber checks if a value is a number
+func isNumber(x any) bool {
+	switch x.(type) {
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64, json.Number:
+		return true
+	default:
+		return false
+	}
+}
+
+// toNumber converts a number or a numeric string to float64
+func toNumber(x any) (float64, bool) {
+	switch x := x.(type) {
+	case string:
+		num, err := strconv.ParseFloat(x, 64)
+		return num, err == nil
+	default:
+		if !isNumber(x) {
+			return 0, false
+		}
+		num, err := cast.ToFloat64E(x)
+		return num, err == nil
+	}
 }
 
 // mulFunc multiplies two values
-func mulFunc(x, y any) any {
-	return cast.ToFloat64(x) * cast.ToFloat64(y)
+// two integers give an integer, anything else gives a float
+func mulFunc(x, y any) (any, error) {
+	return arith(x, y, mulInt64, func(a, b float64) float64 { return a * b })
 }
 
 // divFunc divides two values
-func divFunc(x, y any) any {
-	return cast.ToFloat64(x) / cast.ToFloat64(y)
+// the quotient is always a float, use // for integer division
+// dividing by zero is an error
+func divFunc(x, y any) (any, error) {
+	if isZero(y) {
+		return nil, errDivByZero
+	}
+	a, b, err := toFloat64s(x, y)
+	if err != nil {
+		return nil, err
+	}
+	return a / b, nil
+}
+
+// intDivFunc divides two values and truncates the quotient toward zero
+// two integers give an integer, anything else gives a float
+// dividing by zero is an error
+func intDivFunc(x, y any) (any, error) {
+	if isZero(y) {
+		return nil, errDivByZero
+	}
+	return arith(x, y, quoInt64, func(a, b float64) float64 { return math.Trunc(a / b) })
+}
+
+// moduloFunc returns the remainder of the division of two values
+// with the sign of x
+// two integers give an integer, anything else gives a float
+// dividing by zero is an error
+func moduloFunc(x, y any) (any, error) {
+	if isZero(y) {
+		return nil, errDivByZero
+	}
+	return arith(x, y, remInt64, math.Mod)
 }
 
 // addFunc adds two values
-func addFunc(x, y any) any {
-	return cast.ToFloat64(x) + cast.ToFloat64(y)
+// two integers give an integer, anything else gives a float
+func addFunc(x, y any) (any, error) {
+	return arith(x, y, addInt64, func(a, b float64) float64 { return a + b })
 }
 
 // subFunc subtracts two values
-func subFunc(x, y any) any {
-	return cast.ToFloat64(x) - cast.ToFloat64(y)
+// two integers give an integer, anything else gives a float
+func subFunc(x, y any) (any, error) {
+	return arith(x, y, subInt64, func(a, b float64) float64 { return a - b })
 }
@@ -0,0 +1,52 @@
+package json2json
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// object is a JSON object that keeps the insertion order of its keys
+type object struct {
+	keys   []string
+	values map[string]any
+}
+
+// newObject creates a new object
+func newObject(size int) *object {
+	return &object{
+		keys:   make([]string, 0, size),
+		values: make(map[string]any, size),
+	}
+}
+
+// set sets the value of a key
+func (o *object) set(key string, val any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = val
+}
+
+// MarshalJSON encodes the object with its keys in insertion order
+func (o *object) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -1,173 +1,255 @@
 package json2json
 
 import (
+	"encoding/json"
 	"fmt"
-	"github.com/spf13/cast"
+	"math"
 	"strconv"
-	"strings"
+	"time"
 )
 
 // Parser parses a string and returns the result
 type Parser struct {
 	input     map[string]interface{}
 	funcStack []Func
+	scopes    []scope
+	vars      map[string]any
+	params    []map[string]any
+
+	outOfRange OutOfRange
+	nonFinite  NonFinite
+	decimal    bool
+	scale      int
+	clock      func() time.Time
+}
+
+// ParserOpt is an option of the parser
+type ParserOpt func(*Parser)
+
+// WithOutOfRange sets what an out of range array index
+// like [a[5]] evaluates to, the default is OutOfRangeError
+func WithOutOfRange(outOfRange OutOfRange) ParserOpt {
+	return func(p *Parser) {
+		p.outOfRange = outOfRange
+	}
+}
+
+// WithNonFinite sets what a NaN or infinite number
+// like the result of 1e308 * 10 evaluates to,
+// the default is NonFiniteError
+func WithNonFinite(nonFinite NonFinite) ParserOpt {
+	return func(p *Parser) {
+		p.nonFinite = nonFinite
+	}
+}
+
+// WithDecimal turns on the decimal mode
+// where +, -, * and / compute exactly with decimal numbers
+// and return json.Number, so 0.1 + 0.2 is 0.3
+// a division without a finite decimal form
+// is rounded to scale digits after the decimal point
+func WithDecimal(scale int) ParserOpt {
+	return func(p *Parser) {
+		p.decimal = true
+		p.scale = scale
+	}
+}
+
+// WithClock sets the clock NOW() reads the current time from,
+// the default is time.Now
+func WithClock(clock func() time.Time) ParserOpt {
+	return func(p *Parser) {
+		p.clock = clock
+	}
+}
+
+// scope is an array element that is being processed
+type scope struct {
+	path  []pathSegment
+	elem  any
+	index int
+}
+
+// trim trims the scope path from a key path
+// it returns false if the key path is not inside the scope,
+// which is when it does not go through the array by a field of its elements
+// e.g. [packages.sku] is inside the scope of packages,
+// but [packages], [packages[0].sku], [packages.0.sku],
+// [packages.*.sku] and [packages..sku] are not
+func (s scope) trim(path []pathSegment) ([]pathSegment, bool) {
+	if len(s.path) == 0 || len(path) <= len(s.path) {
+		return nil, false
+	}
+	for i, seg := range s.path {
+		if path[i] != seg {
+			return nil, false
+		}
+	}
+	rest := path[len(s.path):]
+	switch rest[0].kind {
+	case segmentIndex, segmentSlice, segmentWildcard, segmentDescent:
+		return nil, false
+	case segmentField:
+		if _, err := strconv.Atoi(rest[0].field); err == nil {
+			return nil, false
+		}
+	}
+	return rest, true
 }
 
 // NewParser creates a new parser
-func NewParser(input map[string]interface{}) *Parser {
-	return &Parser{
+func NewParser(input map[string]interface{}, opts ...ParserOpt) *Parser {
+	p := Parser{
 		input: input,
+		vars:  make(map[string]any),
+		clock: time.Now,
+	}
+	for _, opt := range opts {
+		opt(&p)
 	}
+	return &p
 }
 
 // Parse parses a string and returns the result
+// it compiles the string on every call,
+// use Compile to evaluate the same expression many times
+// numbers formatted by FLOAT are returned as float64,
+// in decimal mode json.Number is returned as it is
 func (p *Parser) Parse(str string) (any, error) {
-	str = p.removeWhitespace(str)
-	splitBracketStr := strings.SplitN(str, string(LeftBracket), 2)
-	fnStr := Func(splitBracketStr[0])
-	args := make([]any, 0)
-	_, validFunc := fnFunc[fnStr]
-	if validFunc {
-		p.funcStack = append(p.funcStack, fnStr)
-		defer func() {
-			p.funcStack = p.funcStack[:len(p.funcStack)-1]
-		}()
-		argStr := strings.TrimSuffix(strings.TrimPrefix(str, fmt.Sprintf("%s%s", fnStr, string(LeftBracket))), string(RightBracket))
-		argStrSplit := p.splitArgs(argStr)
-		for _, a := range argStrSplit {
-			arg, err := p.Parse(a)
-			if err != nil {
-				return nil, err
-			}
-			args = append(args, arg)
-		}
-	} else {
-		if op, ok := containsOp(str); ok {
-			idx := strings.LastIndex(str, string(op))
-			x, err := p.Parse(str[:idx])
-			if err != nil {
-				return nil, err
-			}
-			y, err := p.Parse(str[idx+1:])
-			if err != nil {
-				return nil, err
-			}
-			return opFunc[op](x, y), nil
-		}
-		strInt, err := strconv.ParseInt(str, 10, 64)
-		if err == nil {
-			return strInt, nil
-		}
-		strFloat, err := strconv.ParseFloat(str, 64)
-		if err == nil {
-			return strFloat, nil
-		}
-		if strings.HasPrefix(str, string(Apostrophe)) && strings.HasSuffix(str, string(Apostrophe)) {
-			return strings.TrimSuffix(strings.TrimPrefix(str, string(Apostrophe)), string(Apostrophe)), nil
-		}
-		if strings.HasPrefix(str, string(LeftSquareBracket)) && strings.HasSuffix(str, string(RightSquareBracket)) {
-			return p.parseInputByKey(str)
-		}
-		if constant, ok := constMap[Const(strings.ToUpper(str))]; ok {
-			return constant, nil
-		}
-		return nil, fmt.Errorf("unknown string %s", str)
+	expr, err := Compile(str)
+	if err != nil {
+		return nil, err
 	}
-	res, err := fnFunc[fnStr](args)
+	res, err := expr.eval(p)
 	if err != nil {
-		return nil, fmt.Errorf("func %s: %w", fnStr, err)
+		return nil, err
+	}
+	if num, ok := res.(json.Number); ok && !p.decimal {
+		return num.Float64()
 	}
 	return res, nil
 }
 
-// removeWhitespace remove all spaces
-// except if inside two apostrophes which defines a hardcoded string
-func (p *Parser) removeWhitespace(str string) string {
-	parts := strings.Split(str, string(Apostrophe))
-	for i := 0; i < len(parts); i += 2 {
-		parts[i] = strings.TrimSpace(parts[i])
-	}
-	trimmed := strings.Join(parts, string(Apostrophe))
-	return trimmed
-}
-
-// splitArgs split args string by comma
-// except for inside other operators:
-// brackets, apostrophes, square brackets
-func (p *Parser) splitArgs(str string) []string {
-	var result []string
-	var buffer strings.Builder
-	var openBrackets int
-	var openApostrophes bool
-	for _, char := range str {
-		switch ParserChar(char) {
-		case Apostrophe:
-			openApostrophes = !openApostrophes
-			buffer.WriteRune(char)
-		case LeftBracket, LeftSquareBracket:
-			openBrackets++
-			buffer.WriteRune(char)
-		case RightBracket, RightSquareBracket:
-			if openBrackets > 0 {
-				openBrackets--
-				buffer.WriteRune(char)
-			}
-		case Comma:
-			if openBrackets == 0 && !openApostrophes {
-				if buffer.Len() > 0 {
-					result = append(result, buffer.String())
-					buffer.Reset()
-				}
-			} else {
-				buffer.WriteRune(char)
-			}
-		default:
-			buffer.WriteRune(char)
-		}
+// evalError creates an error at a byte offset of the expression
+// with the current function call stack
+func (p *Parser) evalError(offset int, err error) error {
+	funcStack := make([]Func, len(p.funcStack))
+	copy(funcStack, p.funcStack)
+	return &Error{
+		Offset:    offset,
+		FuncStack: funcStack,
+		Err:       err,
+	}
+}
+
+// resolveVar replaces the first VAR argument
+// with the value of the variable it names, if any
+func (p *Parser) resolveVar(args []any) []any {
+	if len(args) == 0 {
+		return args
 	}
-	if buffer.Len() > 0 {
-		result = append(result, buffer.String())
+	name, ok := args[0].(string)
+	if !ok {
+		return args
 	}
-	return result
+	if val, ok := p.vars[name]; ok {
+		args[0] = val
+	}
+	return args
 }
 
 // parseInputByKey parse input by key
 // e.g. [key1.key2.key3]
-func (p *Parser) parseInputByKey(str string) (any, error) {
-	key := strings.TrimSuffix(strings.TrimPrefix(str, string(LeftSquareBracket)), string(RightSquareBracket))
-	keyParts := strings.Split(key, string(Dot))
-	inputTemp := make(map[string]any, len(p.input))
-	for k, v := range p.input {
-		inputTemp[k] = v
-	}
-	for i, keyPart := range keyParts {
-		if val, ok := inputTemp[keyPart]; ok {
-			switch val.(type) {
-			case map[string]any:
-				if i == len(keyParts)-1 {
-					return val, nil
-				}
-				inputTemp = val.(map[string]any)
-			case []any:
-				if i == len(keyParts)-1 {
-					return val, nil
-				}
-				inputTemp = make(map[string]any, len(val.([]any)))
-				for i, v := range val.([]any) {
-					inputTemp[cast.ToString(i)] = v
-				}
-			case []map[string]any:
-				if i == len(keyParts)-1 {
-					return val, nil
-				}
-				inputTemp = make(map[string]any, len(val.([]map[string]any)))
-				for i, v := range val.([]map[string]any) {
-					inputTemp[cast.ToString(i)] = v
-				}
-			default:
-				return val, nil
-			}
+// inside an array scope, a key going through the scope path
+// by a field is looked up from the current element of the scope
+// a key with a scope marker like [@.sku], [^.sku] or [$.sku]
+// is looked up from the current element, its parent or the root
+func (p *Parser) parseInputByKey(anchor pathAnchor, path []pathSegment) (any, error) {
+	switch anchor {
+	case anchorRoot:
+		return p.lookupPath(p.input, path)
+	case anchorCurrent:
+		return p.lookupPath(p.element(0), path)
+	case anchorParent:
+		if len(p.scopes) == 0 {
+			return nil, fmt.Errorf("no parent element outside of an array")
+		}
+		return p.lookupPath(p.element(1), path)
+	}
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if rest, ok := p.scopes[i].trim(path); ok {
+			return p.lookupPath(p.scopes[i].elem, rest)
+		}
+	}
+	return p.lookupPath(p.input, path)
+}
+
+// element returns the array element of the nth scope
+// counting outwards from the innermost one
+// outside of the outermost scope, it is the root
+func (p *Parser) element(n int) any {
+	if i := len(p.scopes) - 1 - n; i >= 0 {
+		return p.scopes[i].elem
+	}
+	return p.input
+}
+
+// index returns the position of the current array element
+func (p *Parser) index() (int, error) {
+	if len(p.scopes) == 0 {
+		return 0, fmt.Errorf("no array element")
+	}
+	return p.scopes[len(p.scopes)-1].index, nil
+}
+
+// param returns the argument bound to a lambda parameter
+// by the innermost lambda that has the parameter
+func (p *Parser) param(name string) any {
+	for i := len(p.params) - 1; i >= 0; i-- {
+		if val, ok := p.params[i][name]; ok {
+			return val
 		}
 	}
-	return nil, nil
+	return nil
+}
+
+// callLambda binds the arguments to the parameters of a lambda
+// and evaluates its body, extra arguments are ignored
+func (p *Parser) callLambda(fn any, args ...any) (any, error) {
+	lambda, ok := fn.(*lambdaNode)
+	if !ok {
+		return nil, fmt.Errorf("invalid lambda: %T", fn)
+	}
+	params := make(map[string]any, len(lambda.params))
+	for i, name := range lambda.params {
+		if i < len(args) {
+			params[name] = args[i]
+		}
+	}
+	p.params = append(p.params, params)
+	defer func() {
+		p.params = p.params[:len(p.params)-1]
+	}()
+	res, err := lambda.body.eval(p)
+	if err != nil {
+		return nil, err
+	}
+	return missingToNil(res), nil
+}
+
+// finite checks that a number is neither NaN nor infinite
+// otherwise it returns what the NonFinite of the parser says
+func (p *Parser) finite(val any) (any, error) {
+	f, ok := val.(float64)
+	if !ok || (!math.IsNaN(f) && !math.IsInf(f, 0)) {
+		return val, nil
+	}
+	switch p.nonFinite {
+	case NonFiniteNull:
+		return nil, nil
+	case NonFiniteString:
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	default:
+		return nil, fmt.Errorf("non-finite number %v", f)
+	}
 }
@@ -1,6 +1,15 @@
 package json2json
 
-import "testing"
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestParser_Parse(t *testing.T) {
 	t.Parallel()
@@ -469,6 +478,947 @@ func TestParser_Parse(t *testing.T) {
 			want:      nil,
 			wantErr:   true,
 		},
+		{
+			name:  "operator precedence",
+			input: "[a]+[b]*[c]",
+			jsonInput: map[string]any{
+				"a": 1, "b": 2, "c": 3,
+			},
+			want:    int64(7),
+			wantErr: false,
+		},
+		{
+			name:  "operator parentheses",
+			input: "([a]+[b])*[c]",
+			jsonInput: map[string]any{
+				"a": 1, "b": 2, "c": 3,
+			},
+			want:    int64(9),
+			wantErr: false,
+		},
+		{
+			name:      "operator left associative",
+			input:     "10 - 4 - 3",
+			jsonInput: map[string]any{},
+			want:      int64(3),
+			wantErr:   false,
+		},
+		{
+			name:      "operator comparison after arithmetic",
+			input:     "2 * 3 = 6",
+			jsonInput: map[string]any{},
+			want:      true,
+			wantErr:   false,
+		},
+		{
+			name:      "unary minus",
+			input:     "2 * -3",
+			jsonInput: map[string]any{},
+			want:      int64(-6),
+			wantErr:   false,
+		},
+		{
+			name:      "infix less equal",
+			input:     "LEN('hello') <= 5",
+			jsonInput: map[string]any{},
+			want:      true,
+			wantErr:   false,
+		},
+		{
+			name:      "infix less",
+			input:     "LEN('hello') < 5",
+			jsonInput: map[string]any{},
+			want:      false,
+			wantErr:   false,
+		},
+		{
+			name:      "infix greater equal",
+			input:     "2 >= 2.5",
+			jsonInput: map[string]any{},
+			want:      false,
+			wantErr:   false,
+		},
+		{
+			name:  "infix greater",
+			input: "[a] > 1",
+			jsonInput: map[string]any{
+				"a": 2,
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:      "infix comparison error",
+			input:     "'a' > 1",
+			jsonInput: map[string]any{},
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "infix and or precedence",
+			input:     "TRUE || FALSE && FALSE",
+			jsonInput: map[string]any{},
+			want:      true,
+			wantErr:   false,
+		},
+		{
+			name:      "infix and short circuit",
+			input:     "FALSE && 'a'",
+			jsonInput: map[string]any{},
+			want:      false,
+			wantErr:   false,
+		},
+		{
+			name:      "infix or error",
+			input:     "FALSE || 'a'",
+			jsonInput: map[string]any{},
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "prefix not",
+			input:     "!(1 > 2) && !FALSE",
+			jsonInput: map[string]any{},
+			want:      true,
+			wantErr:   false,
+		},
+		{
+			name:      "prefix not error",
+			input:     "!'a'",
+			jsonInput: map[string]any{},
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:  "key index",
+			input: "[a[0].b]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    "x",
+			wantErr: false,
+		},
+		{
+			name:  "key negative index",
+			input: "[a[-1].b]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    "z",
+			wantErr: false,
+		},
+		{
+			name:  "key dotted index",
+			input: "[a.1.b]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    "y",
+			wantErr: false,
+		},
+		{
+			name:  "key dotted index out of range",
+			input: "[a.5.b]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:  "key slice",
+			input: "LEN([a[1:3]])",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    3 - 1,
+			wantErr: false,
+		},
+		{
+			name:  "key slice negative start",
+			input: "LEN([a[-2:]])",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name:  "key slice open start",
+			input: "[a[:2][-1].b]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    "y",
+			wantErr: false,
+		},
+		{
+			name:  "key slice out of range",
+			input: "LEN([a[5:]])",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:  "error key index out of range",
+			input: "[a[3].b]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error key negative index out of range",
+			input: "[a[-4]]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error key invalid index",
+			input: "[a[x]]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error key empty field",
+			input: "[a.]",
+			jsonInput: map[string]any{
+				"a": []any{
+					map[string]any{"b": "x"},
+					map[string]any{"b": "y"},
+					map[string]any{"b": "z"},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "key wildcard",
+			input: "LEN([order.packages.*.sku])",
+			jsonInput: map[string]any{
+				"order": map[string]any{
+					"price": int64(5),
+					"packages": []any{
+						map[string]any{"sku": "a", "price": int64(1)},
+						map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+						map[string]any{"qty": int64(3)},
+					},
+				},
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name:  "key wildcard index",
+			input: "LEN([order.packages[*].sku])",
+			jsonInput: map[string]any{
+				"order": map[string]any{
+					"price": int64(5),
+					"packages": []any{
+						map[string]any{"sku": "a", "price": int64(1)},
+						map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+						map[string]any{"qty": int64(3)},
+					},
+				},
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name:  "key wildcard object",
+			input: "LEN([order.*])",
+			jsonInput: map[string]any{
+				"order": map[string]any{
+					"price": int64(5),
+					"packages": []any{
+						map[string]any{"sku": "a", "price": int64(1)},
+						map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+						map[string]any{"qty": int64(3)},
+					},
+				},
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name:  "key descent",
+			input: "LEN([order..price])",
+			jsonInput: map[string]any{
+				"order": map[string]any{
+					"price": int64(5),
+					"packages": []any{
+						map[string]any{"sku": "a", "price": int64(1)},
+						map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+						map[string]any{"qty": int64(3)},
+					},
+				},
+			},
+			want:    3,
+			wantErr: false,
+		},
+		{
+			name:  "key descent nested",
+			input: "LEN([order.packages..price])",
+			jsonInput: map[string]any{
+				"order": map[string]any{
+					"price": int64(5),
+					"packages": []any{
+						map[string]any{"sku": "a", "price": int64(1)},
+						map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+						map[string]any{"qty": int64(3)},
+					},
+				},
+			},
+			want:    2,
+			wantErr: false,
+		},
+		{
+			name:  "key wildcard empty",
+			input: "LEN([order.missing.*])",
+			jsonInput: map[string]any{
+				"order": map[string]any{
+					"price": int64(5),
+					"packages": []any{
+						map[string]any{"sku": "a", "price": int64(1)},
+						map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+						map[string]any{"qty": int64(3)},
+					},
+				},
+			},
+			want:    0,
+			wantErr: false,
+		},
+		{
+			name:  "key quoted field",
+			input: "['shipping.fee'.amount]",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    int64(5),
+			wantErr: false,
+		},
+		{
+			name:  "key bracket quoted field",
+			input: "[['shipping.fee'].amount]",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    int64(5),
+			wantErr: false,
+		},
+		{
+			name:  "key escaped dot",
+			input: "[shipping\\.fee.amount]",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    int64(5),
+			wantErr: false,
+		},
+		{
+			name:  "key quoted hyphen",
+			input: "['x-request-id']",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    "abc",
+			wantErr: false,
+		},
+		{
+			name:  "key quoted brackets",
+			input: "['items[0]']",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    "first",
+			wantErr: false,
+		},
+		{
+			name:  "key escaped brackets",
+			input: "[items\\[0\\]]",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    "first",
+			wantErr: false,
+		},
+		{
+			name:  "key escaped apostrophe",
+			input: "['it\\'s']",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    "quote",
+			wantErr: false,
+		},
+		{
+			name:  "key quoted wildcard",
+			input: "['*']",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    "star",
+			wantErr: false,
+		},
+		{
+			name:  "key quoted field after dot",
+			input: "[a.'b']",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    "c",
+			wantErr: false,
+		},
+		{
+			name:  "key apostrophe inside field",
+			input: "[it's]",
+			jsonInput: map[string]any{
+				"it's": "quote",
+			},
+			want:    "quote",
+			wantErr: false,
+		},
+		{
+			name:  "key apostrophe inside field after dot",
+			input: "[p.o'b]",
+			jsonInput: map[string]any{
+				"p": map[string]any{"o'b": "x"},
+			},
+			want:    "x",
+			wantErr: false,
+		},
+		{
+			name:  "key escaped dot before apostrophe",
+			input: "[a\\.'b]",
+			jsonInput: map[string]any{
+				"a.'b": "y",
+			},
+			want:    "y",
+			wantErr: false,
+		},
+		{
+			name:  "error key unterminated quote",
+			input: "['a]",
+			jsonInput: map[string]any{
+				"shipping.fee": map[string]any{"amount": int64(5)},
+				"x-request-id": "abc",
+				"items[0]":     "first",
+				"it's":         "quote",
+				"*":            "star",
+				"a":            map[string]any{"b": "c"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "exists present",
+			input: "EXISTS([b])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:  "exists null",
+			input: "EXISTS([a])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:  "exists missing",
+			input: "EXISTS([z])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "exists nested null",
+			input: "EXISTS([c.d])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:  "exists nested missing",
+			input: "EXISTS([c.e.f])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "exists inside string",
+			input: "EXISTS([b.e])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "exists missing constant",
+			input: "EXISTS(MISSING)",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "exists index out of range",
+			input: "EXISTS([arr[5]])",
+			jsonInput: map[string]any{
+				"arr": []any{"x"},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "error exists index out of range inside expression",
+			input: "EXISTS(STRING([arr[5]]))",
+			jsonInput: map[string]any{
+				"arr": []any{"x"},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error exists arguments",
+			input: "EXISTS([a], [b])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "is null",
+			input: "IS_NULL([a])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:  "is null missing",
+			input: "IS_NULL([z])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "is null index out of range",
+			input: "IS_NULL([arr[-2]])",
+			jsonInput: map[string]any{
+				"arr": []any{nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "is null present",
+			input: "IS_NULL([b])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "coalesce",
+			input: "COALESCE([z], [a], [b], 'y')",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    "x",
+			wantErr: false,
+		},
+		{
+			name:  "coalesce index out of range",
+			input: "COALESCE([arr[5]], [arr[0]])",
+			jsonInput: map[string]any{
+				"arr": []any{"x"},
+			},
+			want:    "x",
+			wantErr: false,
+		},
+		{
+			name:  "coalesce none",
+			input: "COALESCE([z], [a])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:  "error coalesce arguments",
+			input: "COALESCE()",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "missing key is nil",
+			input: "[z]",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name:  "missing key in operator",
+			input: "[z] = NIL",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:  "missing key in function",
+			input: "STRING([z])",
+			jsonInput: map[string]any{
+				"a": nil,
+				"b": "x",
+				"c": map[string]any{"d": nil},
+			},
+			want:    "",
+			wantErr: false,
+		},
+		{
+			name:  "pointer",
+			input: "[/packages/0/sku]",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    "a",
+			wantErr: false,
+		},
+		{
+			name:  "pointer dotted key",
+			input: "[/shipping.fee]",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    int64(5),
+			wantErr: false,
+		},
+		{
+			name:  "pointer escaped slash",
+			input: "[/a~1b]",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    "slash",
+			wantErr: false,
+		},
+		{
+			name:  "pointer escaped tilde",
+			input: "[/m~0n]",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    "tilde",
+			wantErr: false,
+		},
+		{
+			name:  "pointer apostrophe",
+			input: "[/it's]",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    "quote",
+			wantErr: false,
+		},
+		{
+			name:  "pointer past the end",
+			input: "EXISTS([/packages/-])",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    false,
+			wantErr: false,
+		},
+		{
+			name:  "pointer in operator",
+			input: "[/shipping.fee] * 2",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    int64(10),
+			wantErr: false,
+		},
+		{
+			name:  "error pointer escape",
+			input: "[/a~2b]",
+			jsonInput: map[string]any{
+				"packages":     []any{map[string]any{"sku": "a"}},
+				"shipping.fee": int64(5),
+				"a/b":          "slash",
+				"m~n":          "tilde",
+				"it's":         "quote",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "root key",
+			input: "[$.a]",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    "root",
+			wantErr: false,
+		},
+		{
+			name:  "current key outside array",
+			input: "[@.a]",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    "root",
+			wantErr: false,
+		},
+		{
+			name:  "current element outside array",
+			input: "LEN([@])",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    1,
+			wantErr: false,
+		},
+		{
+			name:  "error parent key outside array",
+			input: "[^.a]",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error index outside array",
+			input: "INDEX()",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error index arguments",
+			input: "INDEX(1)",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:  "error scope marker",
+			input: "[@a]",
+			jsonInput: map[string]any{
+				"a": "root",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name:      "error unbalanced parentheses",
+			input:     "(1 + 2",
+			jsonInput: map[string]any{},
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "error trailing token",
+			input:     "1 2",
+			jsonInput: map[string]any{},
+			want:      nil,
+			wantErr:   true,
+		},
+		{
+			name:      "error unknown func",
+			input:     "UNKNOWN(1)",
+			jsonInput: map[string]any{},
+			want:      nil,
+			wantErr:   true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -488,24 +1438,784 @@ func TestParser_Parse(t *testing.T) {
 	}
 }
 
-func TestRemoveWhitespace(t *testing.T) {
-	input := "STRING('a b c') "
-	p := NewParser(map[string]any{})
-	trimmed := p.removeWhitespace(input)
-	if trimmed != "STRING('a b c')" {
-		t.Errorf("error trimming whitespace: %s", trimmed)
+func TestParser_Projection(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"order": map[string]any{
+			"price": int64(5),
+			"packages": []any{
+				map[string]any{"sku": "a", "price": int64(1)},
+				map[string]any{"sku": "b", "items": []any{map[string]any{"price": int64(2)}}},
+			},
+		},
+	}
+	tests := []struct {
+		input string
+		want  []any
+	}{
+		{input: "[order.packages.*.sku]", want: []any{"a", "b"}},
+		{input: "[order..price]", want: []any{int64(5), int64(1), int64(2)}},
+		{input: "[order.packages[*].items[0].price]", want: []any{int64(2)}},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input).Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parser.Parse(%s) error = %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParser_JSONPath(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"tracking_number": "TN1",
+		"max":             int64(3),
+		"packages": []any{
+			map[string]any{"sku": "a", "quantity": int64(1), "tags": []any{"x"}},
+			map[string]any{"sku": "bb", "quantity": int64(3), "fragile": true},
+			map[string]any{"sku": "c", "quantity": 2.0, "tags": []any{"x", "y"}},
+		},
+		"shipping.fee": int64(7),
+	}
+	tests := []struct {
+		input   string
+		want    any
+		wantErr bool
+	}{
+		{input: "$.tracking_number", want: "TN1"},
+		{input: "$['shipping.fee']", want: int64(7)},
+		{input: `$["shipping.fee"] * 2`, want: int64(14)},
+		{input: "$.packages[-1].sku", want: "c"},
+		{input: "$.missing", want: nil},
+		{input: "EXISTS($.missing)", want: false},
+		{input: "$.packages[?@.quantity > 1].sku", want: []any{"bb", "c"}},
+		{input: "$.packages[?@.quantity == $.max].sku", want: []any{"bb"}},
+		{input: "$.packages[?@.fragile].sku", want: []any{"bb"}},
+		{input: "$.packages[?!@.fragile && @.quantity < 2].sku", want: []any{"a"}},
+		{input: "$.packages[?(@.sku == 'a' || @.sku == \"c\")].quantity", want: []any{int64(1), 2.0}},
+		{input: "$.packages[?length(@.sku) == 2].sku", want: []any{"bb"}},
+		{input: "$.packages[?count(@.tags[*]) > 1].sku", want: []any{"c"}},
+		{input: "$.packages[?match(@.sku, 'b+')].sku", want: []any{"bb"}},
+		{input: "$.packages[?search(@.sku, 'b')].sku", want: []any{"bb"}},
+		{input: "$.packages[?value(@.tags[0]) == 'x'].sku", want: []any{"a", "c"}},
+		{input: "$.packages[0, 2].sku", want: []any{"a", "c"}},
+		{input: "$.packages[1:].sku", want: []any{"bb", "c"}},
+		{input: "$.packages[::-1].sku", want: []any{"c", "bb", "a"}},
+		{input: "$.packages.*.sku", want: []any{"a", "bb", "c"}},
+		{input: "$..tags[0]", want: []any{"x", "x"}},
+		{input: "$.packages[?@.quantity > 5]", want: []any{}},
+		{input: "LEN($.packages[?@.quantity >= 2])", want: 2},
+		{input: "$.", wantErr: true},
+		{input: "$.packages[?@.quantity >]", wantErr: true},
+		{input: "$.packages[?1]", wantErr: true},
+		{input: "$.packages[?unknown(@.sku)]", wantErr: true},
+		{input: "$.packages[?count(1)]", wantErr: true},
+		{input: "$['a'", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParser_OutOfRange(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{"a": []any{int64(1)}}
+	got, err := NewParser(input, WithOutOfRange(OutOfRangeNoParam)).Parse("[a[1]]")
+	if err != nil {
+		t.Fatalf("Parser.Parse() error = %v", err)
+	}
+	if !isNoParam(got) {
+		t.Errorf("Parser.Parse() = %v, want NO_PARAM", got)
+	}
+}
+
+func TestParser_Numbers(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"id":    json.Number("9007199254740993"),
+		"qty":   json.Number("2"),
+		"price": json.Number("19.99"),
+		"s":     "abc",
+	}
+	tests := []struct {
+		input   string
+		opts    []ParserOpt
+		want    any
+		wantErr bool
+	}{
+		{input: "[id] + 1", want: int64(9007199254740994)},
+		{input: "[qty] * 2", want: int64(4)},
+		{input: "[qty] - 3", want: int64(-1)},
+		{input: "-[qty]", want: int64(-2)},
+		{input: "[price] * 2", want: 39.98},
+		{input: "INT([price])", want: int64(19)},
+		{input: "INT([qty])", want: int64(2)},
+		{input: "INT(FLOAT(2.5))", want: int64(2)},
+		{input: "INT(ROUND(2.45, 1))", want: int64(2)},
+		{input: "STRING(FLOAT(2, 1))", want: "2"},
+		{input: "STRING(FLOAT([price], 3))", want: "19.99"},
+		{input: "STRING([id])", want: "9007199254740993"},
+		{input: "CONCAT(FLOAT(2.5), 'kg')", want: "2.5kg"},
+		{input: "BOOL(FLOAT(0.5))", want: true},
+		{input: "IF(FLOAT(0), 'a', 'b')", want: "b"},
+		{input: "SLICE_STR('abcdef', [qty], [price] / 4)", want: "cd"},
+		{input: "REPEAT('ab', [qty] + 0.5)", want: "abab"},
+		{input: "ROUND([price], [qty] + 0.5)", want: 19.99},
+		{input: "0.1 + 0.2", want: 0.30000000000000004},
+		{input: "9223372036854775807 + 1", wantErr: true},
+		{input: "-9223372036854775807 - 2", wantErr: true},
+		{input: "-9223372036854775808", want: int64(math.MinInt64)},
+		{input: "-9223372036854775808 + 1", want: int64(math.MinInt64 + 1)},
+		{input: "-9223372036854775809", want: -9223372036854775809.0},
+		{input: "[s] * 2", wantErr: true},
+		{input: "'abc' + 1", wantErr: true},
+		{input: "[s] / 2", wantErr: true},
+		{input: "2 / [s]", wantErr: true},
+		{input: "[s] % 2.5", wantErr: true},
+		{input: "'2' + 1", want: float64(3)},
+		{input: "[qty] * 9223372036854775807", wantErr: true},
+		{input: "7 / 2", want: 3.5},
+		{input: "4 / 2", want: float64(2)},
+		{input: "7 // 2", want: int64(3)},
+		{input: "-7 // 2", want: int64(-3)},
+		{input: "7.5 // 2", want: float64(3)},
+		{input: "7 % 3", want: int64(1)},
+		{input: "-7 % 3", want: int64(-1)},
+		{input: "7.5 % 2", want: 1.5},
+		{input: "2 + 3 % 2", want: int64(3)},
+		{input: "[qty] / 0", wantErr: true},
+		{input: "IF([qty] = 0, 0, 1 / [qty])", want: 0.5},
+		{input: "IF([qty] <> 0, 0, 1 / ([qty] - 2))", want: int64(0)},
+		{input: "IF([qty] = 2, 1 / ([qty] - 2), 0)", wantErr: true},
+		{input: "SWITCH(STRING([qty]), '2', 'two', 1 / 0, 'x', 'default')", want: "two"},
+		{input: "SWITCH([qty], 3, 1 / 0, 'default')", want: "default"},
+		{input: "SWITCH([qty], 1, 'one', 2, 'two', 'other')", want: "two"},
+		{input: "AND([qty] = 0, 1 / 0 > 0)", want: false},
+		{input: "OR([qty] = 2, 1 / 0 > 0)", want: true},
+		{input: "AND([qty] = 2, 1 / 0 > 0)", wantErr: true},
+		{input: "[qty] / [missing]", wantErr: true},
+		{input: "1e308 * 10", wantErr: true},
+		{input: "1e308 * 10", opts: []ParserOpt{WithNonFinite(NonFiniteNull)}, want: nil},
+		{input: "1e308 * 10", opts: []ParserOpt{WithNonFinite(NonFiniteString)}, want: "+Inf"},
+		{input: "-1e308 * 10", opts: []ParserOpt{WithNonFinite(NonFiniteString)}, want: "-Inf"},
+		{input: "SAFE_DIV(3, 2, 0)", want: 1.5},
+		{input: "SAFE_DIV([qty], 0, -1)", want: int64(-1)},
+		{input: "SAFE_DIV([qty], [missing], NIL)", want: nil},
+		{input: "SAFE_DIV(1, 2)", wantErr: true},
+		{input: "SAFE_DIV(1, 3, 0)", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("0.3333333333333333")},
+		{input: "[qty] // 0", wantErr: true},
+		{input: "[qty] % 0", wantErr: true},
+		{input: "[id] = 9007199254740993", want: true},
+		{input: "[id] = 9007199254740992", want: false},
+		{input: "[id] > 9007199254740992", want: true},
+		{input: "[id] >= 9007199254740994", want: false},
+		{input: "LT(9007199254740992, [id])", want: true},
+		{input: "[price] <= 19.99", want: true},
+		{input: "[price] < 19.99", want: false},
+		{input: "GTE(1.5, '1.5')", want: true},
+		{input: "[qty] > 'x'", wantErr: true},
+		{input: "FLOAT(1.005, 2)", want: 1.01},
+		{input: "FLOAT([price], 1)", want: 20.0},
+		{input: "FLOAT(1.5, 100000000)", wantErr: true},
+		{input: "0.1 + 0.2", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("0.3")},
+		{input: "[price] * 3", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("59.97")},
+		{input: "[id] + 1", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("9007199254740994")},
+		{input: "10 / 4", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("2.5")},
+		{input: "1 / 3", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("0.3333333333333333")},
+		{input: "2 / 3", opts: []ParserOpt{WithDecimal(4)}, want: json.Number("0.6667")},
+		{input: "-[price]", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("-19.99")},
+		{input: "FLOAT(1.005, 2)", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("1.01")},
+		{input: "7.5 // 2", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("3")},
+		{input: "-7.5 % 2", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("-1.5")},
+		{input: "1 / 0", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, wantErr: true},
+		{input: "1 % 0", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, wantErr: true},
+		{input: "'abc' * 2", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input, tt.opts...).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParser_Strings(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"code":  "  ab-Ça-01 ",
+		"city":  "São Paulo",
+		"parts": []any{"a", int64(1), true},
+		"huge":  json.Number("4611686018427387904"),
+	}
+	tests := []struct {
+		input   string
+		want    any
+		wantErr bool
+	}{
+		{input: "UPPER([city])", want: "SÃO PAULO"},
+		{input: "LOWER([city])", want: "são paulo"},
+		{input: "TRIM([code])", want: "ab-Ça-01"},
+		{input: "TRIM_LEFT([code])", want: "ab-Ça-01 "},
+		{input: "TRIM_RIGHT([code])", want: "  ab-Ça-01"},
+		{input: "TRIM('xxaxx', 'x')", want: "a"},
+		{input: "TRIM_LEFT('0012', '0')", want: "12"},
+		{input: "TRIM_RIGHT('1.500', '0')", want: "1.5"},
+		{input: "REPLACE('a-b-c', '-', '')", want: "abc"},
+		{input: "REPLACE('a-b-c', '-', '/', 1)", want: "a/b-c"},
+		{input: "SPLIT('a,b,,c', ',')", want: []any{"a", "b", "", "c"}},
+		{input: "SPLIT('São', '')", want: []any{"S", "ã", "o"}},
+		{input: "JOIN([parts], '|')", want: "a|1|true"},
+		{input: "JOIN(SPLIT('a b', ' '), '-')", want: "a-b"},
+		{input: "CONCAT('ID-', 42, '-', [city])", want: "ID-42-São Paulo"},
+		{input: "PAD_LEFT(7, 3, '0')", want: "007"},
+		{input: "PAD_LEFT('ã', 4, 'ab')", want: "abaã"},
+		{input: "PAD_RIGHT([city], 11, '.')", want: "São Paulo.."},
+		{input: "PAD_RIGHT('abc', 2)", want: "abc"},
+		{input: "PAD_LEFT('a', 3)", want: "  a"},
+		{input: "CONTAINS([city], 'ão')", want: true},
+		{input: "STARTS_WITH([city], 'São')", want: true},
+		{input: "ENDS_WITH([city], 'Rio')", want: false},
+		{input: "INDEX_OF([city], 'Paulo')", want: 4},
+		{input: "INDEX_OF([city], 'Rio')", want: -1},
+		{input: "REPEAT('ab', 3)", want: "ababab"},
+		{input: "UPPER()", wantErr: true},
+		{input: "TRIM('a', 'b', 'c')", wantErr: true},
+		{input: "JOIN('a', ',')", wantErr: true},
+		{input: "CONCAT()", wantErr: true},
+		{input: "PAD_LEFT('a', 3, '')", wantErr: true},
+		{input: "REPEAT('a', -1)", wantErr: true},
+		{input: "REPEAT('a', 'b')", wantErr: true},
+		{input: "REPEAT('ab', [huge])", wantErr: true},
+		{input: "PAD_LEFT('7', [huge], '0')", wantErr: true},
+		{input: "PAD_RIGHT('7', [huge])", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParser_Regex(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"tn":      "JP123456789ID",
+		"pattern": `^[A-Z]{2}\d+`,
+		"text":    "a1 b22 c333",
+	}
+	tests := []struct {
+		input   string
+		want    any
+		wantErr bool
+	}{
+		{input: `REGEX_MATCH([tn], '^JP\d{9}ID$')`, want: true},
+		{input: `REGEX_MATCH([tn], '^\d+$')`, want: false},
+		{input: "REGEX_MATCH([tn], [pattern])", want: true},
+		{input: `REGEX_EXTRACT([text], '\d+')`, want: "1"},
+		{input: `REGEX_EXTRACT([text], '([a-z])(\d+)', 2)`, want: "1"},
+		{input: `REGEX_EXTRACT([tn], '(?P<carrier>[A-Z]{2})(?P<number>\d+)', 'number')`, want: "123456789"},
+		{input: "REGEX_EXTRACT([tn], 'x')", want: nil},
+		{input: `REGEX_EXTRACT_ALL([text], '\d+')`, want: []any{"1", "22", "333"}},
+		{input: `REGEX_EXTRACT_ALL([text], '([a-z])\d', 1)`, want: []any{"a", "b", "c"}},
+		{input: "REGEX_EXTRACT_ALL([text], 'x')", want: []any{}},
+		{input: `REGEX_GROUPS([tn], '(?P<carrier>[A-Z]{2})(?P<number>\d+)(?P<suffix>x)?')`, want: map[string]any{"carrier": "JP", "number": "123456789", "suffix": nil}},
+		{input: "REGEX_GROUPS([tn], '(?P<x>z)')", want: nil},
+		{input: `REGEX_REPLACE([text], '([a-z])(\d+)', '${2}$1')`, want: "1a 22b 333c"},
+		{input: "REGEX_MATCH([tn])", wantErr: true},
+		{input: "REGEX_MATCH([tn], '(')", wantErr: true},
+		{input: "REGEX_MATCH([tn], STRING('('))", wantErr: true},
+		{input: "REGEX_EXTRACT([tn], '(a)', 2)", wantErr: true},
+		{input: "REGEX_EXTRACT([tn], '(a)', 'name')", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCompile_Pattern(t *testing.T) {
+	t.Parallel()
+
+	expr, err := Compile(`REGEX_MATCH([tn], '^\d+$')`)
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	lit, ok := expr.root.(*callNode).args[1].(*literalNode)
+	if !ok {
+		t.Fatalf("Compile() pattern = %T, want *literalNode", expr.root.(*callNode).args[1])
+	}
+	if _, ok = lit.val.(*regexp.Regexp); !ok {
+		t.Errorf("Compile() pattern = %T, want *regexp.Regexp", lit.val)
+	}
+
+	_, err = Compile("REGEX_MATCH([tn], '(')")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Compile() error = %v, want *Error", err)
+	}
+	if e.Offset != 18 {
+		t.Errorf("Error offset = %d, want 18", e.Offset)
+	}
+}
+
+func TestParser_Math(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"amount":  json.Number("2.345"),
+		"weights": []any{json.Number("1.2"), json.Number("3"), nil, json.Number("0.5")},
+		"neg":     json.Number("-7"),
+	}
+	tests := []struct {
+		input   string
+		opts    []ParserOpt
+		want    any
+		wantErr bool
+	}{
+		{input: "ROUND(2.5)", want: 3.0},
+		{input: "ROUND(-2.5)", want: -3.0},
+		{input: "ROUND([amount], 2)", want: 2.35},
+		{input: "ROUND([amount], 2, 'HALF_EVEN')", want: 2.34},
+		{input: "ROUND(2.355, 2, 'half_even')", want: 2.36},
+		{input: "ROUND(2.5, 0, 'HALF_EVEN')", want: 2.0},
+		{input: "ROUND(2.341, 2, 'UP')", want: 2.35},
+		{input: "ROUND(-2.349, 2, 'DOWN')", want: -2.34},
+		{input: "ROUND(-2.341, 2, 'CEILING')", want: -2.34},
+		{input: "ROUND(-2.341, 2, 'FLOOR')", want: -2.35},
+		{input: "ROUND(1250, -2)", want: 1300.0},
+		{input: "ROUND(1250, -2, 'HALF_EVEN')", want: 1200.0},
+		{input: "ROUND(1.5, 340)", want: 1.5},
+		{input: "ROUND([amount], 2, 'HALF_EVEN')", opts: []ParserOpt{WithDecimal(DefaultDecimalScale)}, want: json.Number("2.34")},
+		{input: "FLOOR(-1.5)", want: -2.0},
+		{input: "FLOOR([amount], 1)", want: 2.3},
+		{input: "CEIL(1.01)", want: 2.0},
+		{input: "CEIL([amount], 1)", want: 2.4},
+		{input: "ABS([neg])", want: int64(7)},
+		{input: "ABS(-1.5)", want: 1.5},
+		{input: "ABS(0 - 2.5)", want: 2.5},
+		{input: "MIN(3, 1, 2)", want: int64(1)},
+		{input: "MAX(3, 1.5, 2)", want: int64(3)},
+		{input: "MIN([weights])", want: 0.5},
+		{input: "MAX([weights])", want: 3.0},
+		{input: "MAX(NIL, NIL)", want: nil},
+		{input: "CLAMP(15, 0, 10)", want: int64(10)},
+		{input: "CLAMP([neg], 0, 10)", want: int64(0)},
+		{input: "CLAMP(2.5, 0, 10)", want: 2.5},
+		{input: "POW(2, 10)", want: int64(1024)},
+		{input: "POW(-3, 3)", want: int64(-27)},
+		{input: "POW(2, -1)", want: 0.5},
+		{input: "POW(4, 0.5)", want: 2.0},
+		{input: "SQRT(2.25)", want: 1.5},
+		{input: "MOD(7, 3)", want: int64(1)},
+		{input: "MOD(-7, 3)", want: int64(2)},
+		{input: "MOD(7, -3)", want: int64(-2)},
+		{input: "MOD(-7.5, 2)", want: 0.5},
+		{input: "ROUND()", wantErr: true},
+		{input: "ROUND(1, 2, 'NEAREST')", wantErr: true},
+		{input: "ROUND('x')", wantErr: true},
+		{input: "FLOOR(1, 2, 'UP')", wantErr: true},
+		{input: "ROUND(1.5, 100000000)", wantErr: true},
+		{input: "ROUND(1.5, -100000000)", wantErr: true},
+		{input: "FLOOR(1.5, 100000000)", wantErr: true},
+		{input: "CEIL(1.5, -100000000)", wantErr: true},
+		{input: "ABS(1, 2)", wantErr: true},
+		{input: "MIN()", wantErr: true},
+		{input: "MIN(1, 'x')", wantErr: true},
+		{input: "CLAMP(1, 10, 0)", wantErr: true},
+		{input: "POW(2, 64)", wantErr: true},
+		{input: "SQRT(-1)", wantErr: true},
+		{input: "SQRT(-1)", opts: []ParserOpt{WithNonFinite(NonFiniteNull)}, want: nil},
+		{input: "MOD(1, 0)", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input, tt.opts...).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParser_Lambda(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"packages": []any{
+			map[string]any{"sku": "a", "quantity": json.Number("2"), "item_weight": json.Number("1.5"), "tags": []any{"x", "y"}},
+			map[string]any{"sku": "b", "quantity": json.Number("0"), "item_weight": json.Number("3"), "tags": []any{}},
+			map[string]any{"sku": "c", "quantity": json.Number("1"), "item_weight": json.Number("0.5"), "tags": []any{"y"}},
+		},
+		"typed": []map[string]any{{"n": 1}, {"n": 2}},
+		"nums":  []any{json.Number("3"), json.Number("1"), json.Number("2")},
+		"min":   json.Number("1"),
+	}
+	tests := []struct {
+		input   string
+		want    any
+		wantErr bool
+	}{
+		{input: "MAP([packages], x => x.quantity * x.item_weight)", want: []any{3.0, int64(0), 0.5}},
+		{input: "MAP([packages], x => x.sku)", want: []any{"a", "b", "c"}},
+		{input: "MAP([packages], (x, i) => CONCAT(i, x.sku))", want: []any{"0a", "1b", "2c"}},
+		{input: "MAP([packages], x => x.missing)", want: []any{nil, nil, nil}},
+		{input: "MAP([typed], x => x.n * 10)", want: []any{int64(10), int64(20)}},
+		{input: "MAP([nums], n => n + 1)", want: []any{int64(4), int64(2), int64(3)}},
+		{input: "MAP([none], x => x)", want: []any{}},
+		{input: "FILTER([packages], x => x.quantity > 0)", want: []any{input["packages"].([]any)[0], input["packages"].([]any)[2]}},
+		{input: "FILTER([nums], n => n > [min])", want: []any{json.Number("3"), json.Number("2")}},
+		{input: "FILTER([nums], (n, i) => i > 0)", want: []any{json.Number("1"), json.Number("2")}},
+		{input: "REDUCE([packages], (sum, x) => sum + x.quantity * x.item_weight, 0)", want: 3.5},
+		{input: "REDUCE([nums], (acc, n, i) => acc + n * i, 0)", want: int64(5)},
+		{input: "REDUCE([none], (acc, n) => acc + n, 7)", want: int64(7)},
+		{input: "FIND([packages], x => x.sku = 'c')", want: input["packages"].([]any)[2]},
+		{input: "FIND([nums], n => n < 3)", want: 1.0},
+		{input: "FIND([nums], n => n > 3)", want: nil},
+		{input: "ANY([packages], x => x.quantity = 0)", want: true},
+		{input: "ANY([packages], x => x.quantity > 5)", want: false},
+		{input: "ALL([packages], x => x.item_weight > 0)", want: true},
+		{input: "ALL([packages], x => x.quantity > 0)", want: false},
+		{input: "ALL([none], x => FALSE)", want: true},
+		{input: "MAP([packages], x => LEN(FILTER(x.tags, t => t = 'y')))", want: []any{1, 0, 1}},
+		{input: "MAP([packages], x => ANY(x.tags, t => x.sku = 'a'))", want: []any{true, false, false}},
+		{input: "SUM", wantErr: true},
+		{input: "MAP([packages])", wantErr: true},
+		{input: "MAP([packages], [sku])", wantErr: true},
+		{input: "MAP([packages], x => y)", wantErr: true},
+		{input: "MAP([packages], (x, i, j) => x)", wantErr: true},
+		{input: "MAP([packages], (x, x) => x)", wantErr: true},
+		{input: "MAP([packages], NIL => 1)", wantErr: true},
+		{input: "MAP([packages], nil => 1)", wantErr: true},
+		{input: "MAP([packages], LEN => 1)", wantErr: true},
+		{input: "MAP([packages], (x, IF) => x)", wantErr: true},
+		{input: "REDUCE([nums], (acc, n) => acc + n)", wantErr: true},
+		{input: "MAP([min], x => x)", wantErr: true},
+		{input: "MAP([packages], x => INT(x.sku))", wantErr: true},
+		{input: "FILTER([packages], x => x.sku)", wantErr: true},
+		{input: "x => x", wantErr: true},
+		{input: "STRING(x => x)", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestParser_Time(t *testing.T) {
+	t.Parallel()
+
+	input := map[string]any{
+		"created":  "2024-03-09 22:15:30",
+		"shipped":  "09/03/2024 11:05 PM",
+		"epoch":    json.Number("1710022530"),
+		"epoch_ms": json.Number("1710022530250"),
+		"rfc":      "2024-03-10T01:30:00+07:00",
+	}
+	clock := func() time.Time {
+		return time.Date(2024, 3, 10, 8, 0, 0, 0, time.FixedZone("WIB", 7*60*60))
+	}
+	tests := []struct {
+		input   string
+		want    any
+		wantErr bool
+	}{
+		{input: "NOW()", want: "2024-03-10T01:00:00Z"},
+		{input: "PARSE_TIME([created], 'DateTime')", want: "2024-03-09T22:15:30Z"},
+		{input: "PARSE_TIME([created], '2006-01-02 15:04:05', 'Asia/Jakarta')", want: "2024-03-09T22:15:30+07:00"},
+		{input: "PARSE_TIME([shipped], '%d/%m/%Y %I:%M %p')", want: "2024-03-09T23:05:00Z"},
+		{input: "PARSE_TIME([epoch], 'unix')", want: "2024-03-09T22:15:30Z"},
+		{input: "PARSE_TIME([epoch_ms], 'unix_ms', 'Asia/Tokyo')", want: "2024-03-10T07:15:30.25+09:00"},
+		{input: "PARSE_TIME('1710022530.5', 'unix')", want: "2024-03-09T22:15:30.5Z"},
+		{input: "FORMAT_TIME([rfc], '%Y-%m-%d %H:%M:%S %z')", want: "2024-03-10 01:30:00 +0700"},
+		{input: "FORMAT_TIME([rfc], 'Jan 2, 2006 3:04 PM', 'America/New_York')", want: "Mar 9, 2024 1:30 PM"},
+		{input: "FORMAT_TIME(PARSE_TIME([epoch_ms], 'unix_ms'), '%H:%M:%S.%f')", want: "22:15:30.250000"},
+		{input: "FORMAT_TIME([rfc], 'unix')", want: int64(1710009000)},
+		{input: "FORMAT_TIME(NOW(), 'day 1 %d')", want: "day 1 10"},
+		{input: "FORMAT_TIME(PARSE_TIME([epoch_ms], 'unix_ms'), '%S%f')", want: "30250000"},
+		{input: "FORMAT_TIME(NOW(), '100%% on %b %e, Mon')", want: "100% on Mar 10, Mon"},
+		{input: "PARSE_TIME('day 1 10', 'day 1 %d')", wantErr: true},
+		{input: "PARSE_TIME('30250000', '%S%f')", wantErr: true},
+		{input: "FORMAT_TIME([rfc], 'unix_ms')", want: int64(1710009000000)},
+		{input: "FORMAT_TIME(NOW(), 'RFC1123Z', 'Asia/Jakarta')", want: "Sun, 10 Mar 2024 08:00:00 +0700"},
+		{input: "TO_ZONE([rfc], 'UTC')", want: "2024-03-09T18:30:00Z"},
+		{input: "TO_ZONE([rfc], 'America/New_York')", want: "2024-03-09T13:30:00-05:00"},
+		{input: "ADD_TIME([rfc], '1h30m')", want: "2024-03-10T03:00:00+07:00"},
+		{input: "ADD_TIME([rfc], '-1d12h')", want: "2024-03-08T13:30:00+07:00"},
+		{input: "SUB_TIME([rfc], '90s')", want: "2024-03-10T01:28:30+07:00"},
+		{input: "ADD_TIME(TO_ZONE([rfc], 'America/New_York'), '1d')", want: "2024-03-10T13:30:00-04:00"},
+		{input: "ADD_TIME(TO_ZONE([rfc], 'America/New_York'), '24h')", want: "2024-03-10T14:30:00-04:00"},
+		{input: "TRUNCATE_TIME([rfc], 'day')", want: "2024-03-10T00:00:00+07:00"},
+		{input: "TRUNCATE_TIME(TO_ZONE([rfc], 'UTC'), 'day')", want: "2024-03-09T00:00:00Z"},
+		{input: "TRUNCATE_TIME([rfc], 'hour')", want: "2024-03-10T01:00:00+07:00"},
+		{input: "TRUNCATE_TIME([rfc], 'month')", want: "2024-03-01T00:00:00+07:00"},
+		{input: "DIFF_TIME(NOW(), [rfc])", want: int64(23400)},
+		{input: "DIFF_TIME(NOW(), [rfc], 'h')", want: 6.5},
+		{input: "DIFF_TIME([rfc], NOW(), 'm')", want: int64(-390)},
+		{input: "DIFF_TIME(NOW(), PARSE_TIME([epoch], 'unix'), 'd')", want: 0.11423611111111111},
+		{input: "NOW(1)", wantErr: true},
+		{input: "PARSE_TIME([created], 'RFC3339')", wantErr: true},
+		{input: "PARSE_TIME([created], '%Y-%m-%d %Q')", wantErr: true},
+		{input: "PARSE_TIME([created], 'DateTime', 'Mars/Olympus')", wantErr: true},
+		{input: "PARSE_TIME([created], 'unix')", wantErr: true},
+		{input: "FORMAT_TIME([created], 'DateTime')", wantErr: true},
+		{input: "ADD_TIME([rfc], '1w')", wantErr: true},
+		{input: "ADD_TIME([rfc], '1d-1h')", wantErr: true},
+		{input: "TRUNCATE_TIME([rfc], 'week')", wantErr: true},
+		{input: "DIFF_TIME(NOW(), [rfc], 'y')", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := NewParser(input, WithClock(clock)).Parse(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Parser.Parse(%s) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if tm, ok := got.(time.Time); ok {
+			got = tm.Format(time.RFC3339Nano)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parser.Parse(%s) = %#v, want %#v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestToLocation(t *testing.T) {
+	t.Parallel()
+
+	loc1, err := toLocation([]any{"Asia/Makassar"}, 0)
+	if err != nil {
+		t.Fatalf("toLocation() error = %v", err)
+	}
+	loc2, err := toLocation([]any{"Asia/Makassar"}, 0)
+	if err != nil {
+		t.Fatalf("toLocation() error = %v", err)
+	}
+	if loc1 != loc2 {
+		t.Errorf("toLocation() = %p, want cached %p", loc2, loc1)
+	}
+	if _, err = toLocation([]any{"Mars/Olympus"}, 0); err == nil {
+		t.Errorf("toLocation() error = nil, want invalid zone")
+	}
+}
+
+func TestLex(t *testing.T) {
+	input := " STRING('a b c') "
+	tokens, err := lex(input)
+	if err != nil {
+		t.Fatalf("error lexing: %v", err)
+	}
+	if tokLen := len(tokens); tokLen != 5 {
+		t.Errorf("error lexing got %d tokens: %v", tokLen, tokens)
+	} else if tokens[2].val != "a b c" {
+		t.Errorf("error keeping whitespace in string: %s", tokens[2].val)
 	} else {
-		t.Logf("success trimming whitespace: %s", trimmed)
+		t.Logf("success lexing got %d tokens: %v", tokLen, tokens)
 	}
 }
 
-func TestSplitByComma(t *testing.T) {
-	input := "VAR([abc],[def]),STRING('a,b')"
-	p := NewParser(map[string]any{})
-	split := p.splitArgs(input)
-	if splitLen := len(split); splitLen != 2 {
-		t.Errorf("error splitting by comma got %d results: %v", splitLen, split)
+func TestCompileArgs(t *testing.T) {
+	input := "SWITCH(VAR([abc],[def]),STRING('a,b'),'(',')')"
+	expr, err := Compile(input)
+	if err != nil {
+		t.Fatalf("error compiling: %v", err)
+	}
+	call, ok := expr.root.(*callNode)
+	if !ok {
+		t.Fatalf("error compiling got %T", expr.root)
+	}
+	if argLen := len(call.args); argLen != 4 {
+		t.Errorf("error splitting args got %d results: %v", argLen, call.args)
 	} else {
-		t.Logf("success splitting by comma got %d results: %v", splitLen, split)
+		t.Logf("success splitting args got %d results: %v", argLen, call.args)
+	}
+}
+
+func TestExpr_Eval(t *testing.T) {
+	t.Parallel()
+
+	expr, err := Compile("IF(GT(LEN([a]), 2), STRING([a]), 'short')")
+	if err != nil {
+		t.Fatalf("error compiling expression: %v", err)
+	}
+	inputs := []map[string]any{
+		{"a": "abc"},
+		{"a": "ab"},
+	}
+	wants := []any{"abc", "short"}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		i := i % len(inputs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := expr.Eval(inputs[i])
+			if err != nil {
+				t.Errorf("Expr.Eval() error = %v", err)
+				return
+			}
+			if got != wants[i] {
+				t.Errorf("Expr.Eval() = %v, want %v", got, wants[i])
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile("STRING(unknown)"); err == nil {
+		t.Errorf("expected error compiling unknown string")
+	}
+}
+
+const benchmarkExpr = "IF(OR([tracking_number]='',LTE(LEN([tracking_number]),5)),'got empty tracking number',FLOAT([weight]*[quantity],1))"
+
+var benchmarkInput = map[string]any{
+	"tracking_number": "1234567890",
+	"weight":          0.5,
+	"quantity":        int64(2),
+}
+
+func BenchmarkParser_Parse(b *testing.B) {
+	p := NewParser(benchmarkInput)
+	for i := 0; i < b.N; i++ {
+		if _, err := p.Parse(benchmarkExpr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExpr_Eval(b *testing.B) {
+	expr, err := Compile(benchmarkExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := expr.Eval(benchmarkInput); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		input      string
+		wantOffset int
+		wantColumn int
+		wantStack  []Func
+		wantCaret  string
+		wantJSON   string
+	}{
+		{
+			name:       "eval error",
+			input:      "IF(TRUE, FLOAT(STRING([a], 1)), 0)",
+			wantOffset: 15,
+			wantColumn: 16,
+			wantStack:  []Func{If, Float, String},
+			wantCaret:  "func IF > FLOAT > STRING: invalid number of arguments: 2 at column 16\nIF(TRUE, FLOAT(STRING([a], 1)), 0)\n               ^",
+			wantJSON:   `{"expr":"IF(TRUE, FLOAT(STRING([a], 1)), 0)","offset":15,"column":16,"func_stack":["IF","FLOAT","STRING"],"error":"invalid number of arguments: 2"}`,
+		},
+		{
+			name:       "operator error",
+			input:      "LEN('é') > 'a'",
+			wantOffset: 10,
+			wantColumn: 10,
+			wantStack:  []Func{},
+			wantCaret:  "operator >: unable to cast \"a\" of type string to float64 at column 10\nLEN('é') > 'a'\n         ^",
+			wantJSON:   `{"expr":"LEN('é') \u003e 'a'","offset":10,"column":10,"error":"operator \u003e: unable to cast \"a\" of type string to float64"}`,
+		},
+		{
+			name:       "division by zero",
+			input:      "FLOAT(1 + 2 / 0)",
+			wantOffset: 12,
+			wantColumn: 13,
+			wantStack:  []Func{Float},
+			wantCaret:  "func FLOAT: operator /: division by zero at column 13\nFLOAT(1 + 2 / 0)\n            ^",
+			wantJSON:   `{"expr":"FLOAT(1 + 2 / 0)","offset":12,"column":13,"func_stack":["FLOAT"],"error":"operator /: division by zero"}`,
+		},
+		{
+			name:       "lambda error",
+			input:      "MAP(SPLIT('x', ','), x => INT(x))",
+			wantOffset: 26,
+			wantColumn: 27,
+			wantStack:  []Func{Map, Int},
+			wantCaret:  "func MAP > INT: unable to cast \"x\" of type string to int64 at column 27\nMAP(SPLIT('x', ','), x => INT(x))\n                          ^",
+			wantJSON:   `{"expr":"MAP(SPLIT('x', ','), x =\u003e INT(x))","offset":26,"column":27,"func_stack":["MAP","INT"],"error":"unable to cast \"x\" of type string to int64"}`,
+		},
+		{
+			name:       "compile error",
+			input:      "STRING('a' 'b')",
+			wantOffset: 11,
+			wantColumn: 12,
+			wantStack:  nil,
+			wantCaret:  "expected , or ), got 'b' at column 12\nSTRING('a' 'b')\n           ^",
+			wantJSON:   `{"expr":"STRING('a' 'b')","offset":11,"column":12,"error":"expected , or ), got 'b'"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := NewParser(map[string]any{}).Parse(tt.input)
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Parser.Parse() error = %v, want *Error", err)
+			}
+			if e.Offset != tt.wantOffset || e.Column != tt.wantColumn {
+				t.Errorf("Error offset, column = %d, %d, want %d, %d", e.Offset, e.Column, tt.wantOffset, tt.wantColumn)
+			}
+			if !reflect.DeepEqual(e.FuncStack, tt.wantStack) {
+				t.Errorf("Error.FuncStack = %v, want %v", e.FuncStack, tt.wantStack)
+			}
+			if caret := e.Caret(); caret != tt.wantCaret {
+				t.Errorf("Error.Caret() = %s, want %s", caret, tt.wantCaret)
+			}
+			if b, err := json.Marshal(e); err != nil || string(b) != tt.wantJSON {
+				t.Errorf("Error.MarshalJSON() = %s, %v, want %s", b, err, tt.wantJSON)
+			}
+		})
 	}
 }
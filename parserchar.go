@@ -7,9 +7,11 @@ type ParserChar string
 const (
 	// LeftBracket is the left bracket
 	// for opening the function call arguments
+	// or a parenthesized sub-expression
 	LeftBracket ParserChar = "("
 	// RightBracket is the right bracket
 	// for closing the function call arguments
+	// or a parenthesized sub-expression
 	RightBracket ParserChar = ")"
 
 	// LeftSquareBracket is the left square bracket
@@ -27,6 +29,41 @@ const (
 	// for defining a key path inside the square brackets
 	Dot ParserChar = "."
 
+	// Wildcard is the wildcard
+	// for every value of an object or an array
+	// inside the square brackets
+	Wildcard ParserChar = "*"
+
+	// Colon is the colon
+	// for separating the start and end of an array slice
+	// inside the square brackets
+	Colon ParserChar = ":"
+
+	// Slash is the slash
+	// for starting a JSON Pointer inside the square brackets
+	// or as an output key, e.g. [/packages/0/sku]
+	Slash ParserChar = "/"
+
+	// Dollar is the dollar sign
+	// for starting a JSONPath query from the root of the input
+	// or an input key from the root, e.g. [$.tracking_number]
+	Dollar ParserChar = "$"
+
+	// At is the at sign
+	// for starting an input key from the current array element
+	// e.g. [@.sku]
+	At ParserChar = "@"
+
+	// Caret is the caret
+	// for starting an input key from the parent array element
+	// e.g. [^.sku]
+	Caret ParserChar = "^"
+
+	// Arrow is the arrow
+	// for separating the parameters of a lambda from its body
+	// e.g. x => x.quantity * x.item_weight
+	Arrow ParserChar = "=>"
+
 	// Comma is the comma
 	// for separating the function call arguments
 	Comma ParserChar = ","
@@ -0,0 +1,519 @@
+package json2json
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// segmentKind is the kind of a path segment
+type segmentKind int
+
+const (
+	// segmentField is a key of an object, e.g. a in [a.b]
+	segmentField segmentKind = iota
+	// segmentIndex is an array index, e.g. [-1] in [a[-1]]
+	segmentIndex
+	// segmentSlice is an array slice, e.g. [1:3] in [a[1:3]]
+	segmentSlice
+	// segmentWildcard is every value of an object or an array,
+	// e.g. * in [a.*.b] or [*] in [a[*].b]
+	segmentWildcard
+	// segmentDescent is a key at any depth, e.g. ..b in [a..b]
+	segmentDescent
+)
+
+// pathSegment is a segment of an input key path
+type pathSegment struct {
+	kind     segmentKind
+	field    string
+	index    int
+	start    int
+	end      int
+	hasStart bool
+	hasEnd   bool
+}
+
+// String returns the segment as it is written in the path
+func (s pathSegment) String() string {
+	switch s.kind {
+	case segmentIndex:
+		return fmt.Sprintf("[%d]", s.index)
+	case segmentWildcard:
+		return string(Wildcard)
+	case segmentDescent:
+		return string(Dot) + s.field
+	case segmentSlice:
+		var b strings.Builder
+		b.WriteString(string(LeftSquareBracket))
+		if s.hasStart {
+			b.WriteString(strconv.Itoa(s.start))
+		}
+		b.WriteString(string(Colon))
+		if s.hasEnd {
+			b.WriteString(strconv.Itoa(s.end))
+		}
+		b.WriteString(string(RightSquareBracket))
+		return b.String()
+	default:
+		return s.field
+	}
+}
+
+// OutOfRange is what an out of range array index evaluates to
+type OutOfRange int
+
+const (
+	// OutOfRangeError fails the evaluation
+	OutOfRangeError OutOfRange = iota
+	// OutOfRangeNoParam evaluates to NO_PARAM
+	OutOfRangeNoParam
+)
+
+// outOfRangeError is the error of an out of range array index
+type outOfRangeError struct {
+	index  int
+	length int
+}
+
+// Error returns the index and the length of the array
+func (e *outOfRangeError) Error() string {
+	return fmt.Sprintf("index %d out of range with length %d", e.index, e.length)
+}
+
+// pathAnchor is where an input key is looked up from
+type pathAnchor int
+
+const (
+	// anchorScope looks up a key from the array element
+	// whose path it starts with, or else from the root
+	anchorScope pathAnchor = iota
+	// anchorCurrent looks up a key from the current array element,
+	// e.g. [@.sku]
+	anchorCurrent
+	// anchorParent looks up a key from the parent array element,
+	// e.g. [^.sku]
+	anchorParent
+	// anchorRoot looks up a key from the root, e.g. [$.tracking_number]
+	anchorRoot
+)
+
+// anchors is the anchor of each scope marker
+var anchors = map[ParserChar]pathAnchor{
+	At:     anchorCurrent,
+	Caret:  anchorParent,
+	Dollar: anchorRoot,
+}
+
+// parseAnchor parses the scope marker at the start of an input key
+// it returns the anchor and the path after the marker
+func parseAnchor(str string) (pathAnchor, string, error) {
+	if str == "" {
+		return anchorScope, str, nil
+	}
+	anchor, ok := anchors[ParserChar(str[0])]
+	if !ok {
+		return anchorScope, str, nil
+	}
+	rest := str[1:]
+	switch {
+	case rest == "", ParserChar(rest[0]) == LeftSquareBracket:
+		return anchor, rest, nil
+	case ParserChar(rest[0]) == Dot:
+		if rest = rest[1:]; rest == "" {
+			return anchorScope, "", fmt.Errorf("empty field in key %s", str)
+		}
+		return anchor, rest, nil
+	default:
+		return anchorScope, "", fmt.Errorf("expected %s or %s after %c in key %s", Dot, LeftSquareBracket, str[0], str)
+	}
+}
+
+// parsePath parses the path of an input key
+// e.g. a.b[0].c, a[-1], a[1:3], a.*.c or a..c
+// a field can be quoted like 'shipping.fee' or ['shipping.fee']
+// or have its special characters escaped like shipping\.fee
+// the quoted field stays inside the brackets of the key,
+// so the field amount of shipping.fee is ['shipping.fee'.amount]
+// or [['shipping.fee'].amount], not ['shipping.fee'].amount
+// a path starting with a slash is a JSON Pointer like /packages/0/sku
+func parsePath(str string) ([]pathSegment, error) {
+	if strings.HasPrefix(str, string(Slash)) {
+		fields, err := parsePointer(str)
+		if err != nil {
+			return nil, err
+		}
+		segments := make([]pathSegment, len(fields))
+		for i, field := range fields {
+			segments[i] = pathSegment{kind: segmentField, field: field}
+		}
+		return segments, nil
+	}
+	var segments []pathSegment
+	i := 0
+	expectField := true
+	descent := false
+	for i < len(str) {
+		switch ParserChar(str[i]) {
+		case LeftSquareBracket:
+			if expectField && len(segments) > 0 {
+				return nil, fmt.Errorf("empty field in key %s", str)
+			}
+			seg, end, err := parseBracket(str, i)
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", str, err)
+			}
+			segments = append(segments, seg)
+			i = end
+			expectField = false
+		case Dot:
+			if expectField {
+				if descent || len(segments) == 0 {
+					return nil, fmt.Errorf("empty field in key %s", str)
+				}
+				descent = true
+			}
+			i++
+			expectField = true
+		default:
+			if !expectField {
+				return nil, fmt.Errorf("expected %s or %s in key %s", Dot, LeftSquareBracket, str)
+			}
+			field, end, literal, err := readField(str, i, string(Dot)+string(LeftSquareBracket))
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", str, err)
+			}
+			seg := pathSegment{kind: segmentField, field: field}
+			switch {
+			case descent:
+				seg.kind = segmentDescent
+			case field == string(Wildcard) && !literal:
+				seg.kind = segmentWildcard
+			}
+			segments = append(segments, seg)
+			i = end
+			expectField = false
+			descent = false
+		}
+	}
+	if expectField {
+		return nil, fmt.Errorf("empty field in key %s", str)
+	}
+	return segments, nil
+}
+
+// parseBracket parses a quoted field, an index or a slice
+// between square brackets starting at i
+// it returns the segment and the position after the brackets
+func parseBracket(str string, i int) (pathSegment, int, error) {
+	if i+1 < len(str) && ParserChar(str[i+1]) == Apostrophe {
+		field, end, _, err := readField(str, i+1, "")
+		if err != nil {
+			return pathSegment{}, 0, err
+		}
+		if end >= len(str) || ParserChar(str[end]) != RightSquareBracket {
+			return pathSegment{}, 0, fmt.Errorf("unterminated index")
+		}
+		return pathSegment{kind: segmentField, field: field}, end + 1, nil
+	}
+	end := strings.IndexByte(str[i:], ']')
+	if end < 0 {
+		return pathSegment{}, 0, fmt.Errorf("unterminated index")
+	}
+	seg, err := parseIndex(str[i+1 : i+end])
+	if err != nil {
+		return pathSegment{}, 0, err
+	}
+	return seg, i + end + 1, nil
+}
+
+// readField reads a field starting at i until one of the stop characters
+// a field between apostrophes is read until the closing apostrophe
+// a backslash escapes the next character
+// it returns the field, the position after it
+// and whether it was quoted or escaped
+func readField(str string, i int, stops string) (string, int, bool, error) {
+	var b strings.Builder
+	quoted := i < len(str) && ParserChar(str[i]) == Apostrophe
+	literal := quoted
+	if quoted {
+		i++
+	}
+	for i < len(str) {
+		c := str[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(str) {
+				return "", 0, false, fmt.Errorf("unterminated escape")
+			}
+			b.WriteByte(str[i+1])
+			i += 2
+			literal = true
+			continue
+		case quoted && ParserChar(c) == Apostrophe:
+			return b.String(), i + 1, literal, nil
+		case !quoted && strings.IndexByte(stops, c) >= 0:
+			return b.String(), i, literal, nil
+		}
+		b.WriteByte(c)
+		i++
+	}
+	if quoted {
+		return "", 0, false, fmt.Errorf("unterminated quoted field")
+	}
+	return b.String(), i, literal, nil
+}
+
+// splitKey splits a dotted output key of a process spec into fields
+// with the same quoting and escaping as input keys
+// e.g. data.'shipping.fee' or data.shipping\.fee
+// a key starting with a slash is a JSON Pointer like /data/shipping.fee
+func splitKey(key string) ([]string, error) {
+	if strings.HasPrefix(key, string(Slash)) {
+		return parsePointer(key)
+	}
+	var fields []string
+	i := 0
+	for {
+		field, end, literal, err := readField(key, i, string(Dot))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		if field == "" && !literal {
+			return nil, fmt.Errorf("empty field in key %s", key)
+		}
+		fields = append(fields, field)
+		if end >= len(key) {
+			return fields, nil
+		}
+		if ParserChar(key[end]) != Dot {
+			return nil, fmt.Errorf("expected %s in key %s", Dot, key)
+		}
+		i = end + 1
+	}
+}
+
+// parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens
+// ~1 is unescaped to / and ~0 to ~
+// an array element is referenced by its index, e.g. /packages/0/sku
+func parsePointer(str string) ([]string, error) {
+	tokens := strings.Split(str[1:], string(Slash))
+	for i, tok := range tokens {
+		for j := 0; j < len(tok); j++ {
+			if tok[j] == '~' && (j+1 >= len(tok) || (tok[j+1] != '0' && tok[j+1] != '1')) {
+				return nil, fmt.Errorf("invalid escape in JSON Pointer %s", str)
+			}
+		}
+		tokens[i] = pointerUnescaper.Replace(tok)
+	}
+	return tokens, nil
+}
+
+// pointerUnescaper unescapes a JSON Pointer reference token
+var pointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parseIndex parses an index or a slice between square brackets
+// e.g. 0, -1, 1:3, :2 or 1:
+func parseIndex(str string) (pathSegment, error) {
+	if str == string(Wildcard) {
+		return pathSegment{kind: segmentWildcard}, nil
+	}
+	startStr, endStr, isSlice := strings.Cut(str, string(Colon))
+	if !isSlice {
+		index, err := strconv.Atoi(str)
+		if err != nil {
+			return pathSegment{}, fmt.Errorf("invalid index %s", str)
+		}
+		return pathSegment{kind: segmentIndex, index: index}, nil
+	}
+	seg := pathSegment{kind: segmentSlice}
+	var err error
+	if startStr != "" {
+		if seg.start, err = strconv.Atoi(startStr); err != nil {
+			return pathSegment{}, fmt.Errorf("invalid slice start %s", startStr)
+		}
+		seg.hasStart = true
+	}
+	if endStr != "" {
+		if seg.end, err = strconv.Atoi(endStr); err != nil {
+			return pathSegment{}, fmt.Errorf("invalid slice end %s", endStr)
+		}
+		seg.hasEnd = true
+	}
+	return seg, nil
+}
+
+// toSlice returns the elements of an array
+func toSlice(val any) ([]any, bool) {
+	switch val := val.(type) {
+	case []any:
+		return val, true
+	case []map[string]any:
+		elems := make([]any, len(val))
+		for i, v := range val {
+			elems[i] = v
+		}
+		return elems, true
+	default:
+		return nil, false
+	}
+}
+
+// lookupPath looks up path segments inside a value
+// it returns MISSING if a field is not found
+// a field of an array is looked up by its index
+// after a wildcard or a descent segment,
+// the following segments are looked up from every match
+// and the matches are returned as an array
+func (p *Parser) lookupPath(val any, segments []pathSegment) (any, error) {
+	vals := []any{val}
+	projected := false
+	for _, seg := range segments {
+		next := make([]any, 0, len(vals))
+		for _, v := range vals {
+			matches, err := p.lookupSegment(v, seg, projected)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, matches...)
+		}
+		vals = next
+		if seg.kind == segmentWildcard || seg.kind == segmentDescent {
+			projected = true
+		}
+		if !projected && len(vals) > 0 && isNoParam(vals[0]) {
+			return vals[0], nil
+		}
+	}
+	if projected {
+		return vals, nil
+	}
+	if len(vals) == 0 {
+		return constMap[Missing], nil
+	}
+	return vals[0], nil
+}
+
+// lookupSegment looks up a path segment inside a value
+// it returns no match if the segment is not found
+// an out of range index is not an error once projected
+func (p *Parser) lookupSegment(val any, seg pathSegment, projected bool) ([]any, error) {
+	switch seg.kind {
+	case segmentField:
+		if v, ok := val.(map[string]any); ok {
+			field, ok := v[seg.field]
+			if !ok {
+				return nil, nil
+			}
+			return []any{field}, nil
+		}
+		elems, ok := toSlice(val)
+		if !ok {
+			return nil, nil
+		}
+		i, err := strconv.Atoi(seg.field)
+		if err != nil || i < 0 || i >= len(elems) {
+			return nil, nil
+		}
+		return []any{elems[i]}, nil
+	case segmentIndex:
+		elems, ok := toSlice(val)
+		if !ok {
+			return nil, nil
+		}
+		i := seg.index
+		if i < 0 {
+			i += len(elems)
+		}
+		if i < 0 || i >= len(elems) {
+			switch {
+			case projected:
+				return nil, nil
+			case p.outOfRange == OutOfRangeNoParam:
+				return []any{constMap[NoParam]}, nil
+			default:
+				return nil, &outOfRangeError{index: seg.index, length: len(elems)}
+			}
+		}
+		return []any{elems[i]}, nil
+	case segmentSlice:
+		elems, ok := toSlice(val)
+		if !ok {
+			return nil, nil
+		}
+		start, end := sliceBounds(seg, len(elems))
+		return []any{append([]any{}, elems[start:end]...)}, nil
+	case segmentWildcard:
+		return children(val), nil
+	case segmentDescent:
+		var matches []any
+		descend(val, func(v any) {
+			if m, ok := v.(map[string]any); ok {
+				if field, ok := m[seg.field]; ok {
+					matches = append(matches, field)
+				}
+			}
+		})
+		return matches, nil
+	default:
+		return nil, nil
+	}
+}
+
+// children returns the values of an object sorted by key
+// or the elements of an array
+func children(val any) []any {
+	if m, ok := val.(map[string]any); ok {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		vals := make([]any, len(keys))
+		for i, k := range keys {
+			vals[i] = m[k]
+		}
+		return vals
+	}
+	elems, _ := toSlice(val)
+	return elems
+}
+
+// descend calls fn for a value and every value nested inside it
+// in document order
+func descend(val any, fn func(any)) {
+	fn(val)
+	for _, child := range children(val) {
+		descend(child, fn)
+	}
+}
+
+// sliceBounds returns the bounds of a slice segment
+// negative bounds count from the end of the array
+// and bounds are clamped to the array
+func sliceBounds(seg pathSegment, length int) (int, int) {
+	clamp := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+	start, end := 0, length
+	if seg.hasStart {
+		start = clamp(seg.start)
+	}
+	if seg.hasEnd {
+		end = clamp(seg.end)
+	}
+	if end < start {
+		end = start
+	}
+	return start, end
+}
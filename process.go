@@ -0,0 +1,336 @@
+package json2json
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// process is a process spec
+// that maps dotted output keys to expressions
+type process struct {
+	root     *node
+	vars     []variable
+	keys     map[string]bool
+	policies map[string]keyPolicy
+	errs     MultiError
+}
+
+// keySpec is a process spec key written as an object
+// e.g. {"expr": "FLOAT([weight])", "on_error": "default", "default": "0"}
+type keySpec struct {
+	Expr    string  `json:"expr"`
+	OnError OnError `json:"on_error"`
+	Default string  `json:"default"`
+}
+
+// node is an output key in the process spec tree
+// e.g. data.tn is the node tn inside the node data
+type node struct {
+	name     string
+	key      string
+	expr     *Expr
+	children []*node
+	index    map[string]*node
+}
+
+// newNode creates a new node
+func newNode(name, key string) *node {
+	return &node{
+		name:  name,
+		key:   key,
+		index: make(map[string]*node),
+	}
+}
+
+// child returns the child node with the given name,
+// creating it if it does not exist yet
+func (n *node) child(name string) *node {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	key := name
+	if n.key != "" {
+		key = n.key + string(Dot) + name
+	}
+	c := newNode(name, key)
+	n.children = append(n.children, c)
+	n.index[name] = c
+	return c
+}
+
+// errDuplicateKey is the error of two keys of a process spec
+// that name the same output key, it fails whatever the ErrorPolicy is
+var errDuplicateKey = fmt.Errorf("duplicate key")
+
+// readProcess reads a process spec,
+// the order of the keys is kept for the output
+// with a collecting error policy, every key that fails to compile
+// is collected, with CollectAndContinue the other keys are still mapped
+// and the errors are returned by every run
+func readProcess(r io.Reader, policy ErrorPolicy) (*process, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, fmt.Errorf("decode process: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("decode process: expected object, got %v", tok)
+	}
+	proc := process{
+		root:     newNode("", ""),
+		keys:     make(map[string]bool),
+		policies: make(map[string]keyPolicy),
+	}
+	for dec.More() {
+		tok, err = dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("decode process: %w", err)
+		}
+		key := tok.(string)
+		var raw json.RawMessage
+		if err = dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("decode process key %s: %w", key, err)
+		}
+		if proc.keys[key] {
+			return nil, fmt.Errorf("decode process: %w %s", errDuplicateKey, key)
+		}
+		proc.keys[key] = true
+		if err = proc.addKey(key, raw); err != nil {
+			if policy == FailFast || errors.Is(err, errDuplicateKey) {
+				return nil, err
+			}
+			proc.errs = append(proc.errs, err)
+		}
+	}
+	if _, err = dec.Token(); err != nil {
+		return nil, fmt.Errorf("decode process: %w", err)
+	}
+	if len(proc.errs) > 0 && policy != CollectAndContinue {
+		return nil, proc.errs
+	}
+	if proc.vars, err = sortVars(proc.vars); err != nil {
+		return nil, err
+	}
+	return &proc, nil
+}
+
+// addKey compiles a key of the process spec
+// and adds it to the variables or the tree
+func (proc *process) addKey(key string, raw json.RawMessage) error {
+	var spec keySpec
+	if err := json.Unmarshal(raw, &spec.Expr); err != nil {
+		if err = json.Unmarshal(raw, &spec); err != nil {
+			return fmt.Errorf("decode process key %s: %w", key, err)
+		}
+		if spec.OnError != "" || spec.Default != "" {
+			err = proc.setPolicy(key, KeyErrorPolicy{OnError: spec.OnError, Default: spec.Default})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	expr, err := Compile(spec.Expr)
+	if err != nil {
+		return withKey(err, key)
+	}
+	if isSetExpr(expr) {
+		proc.vars = append(proc.vars, variable{name: key, expr: expr})
+		return nil
+	}
+	names, err := splitKey(key)
+	if err != nil {
+		return fmt.Errorf("decode process: %w", err)
+	}
+	n := proc.root
+	for _, name := range names {
+		n = n.child(name)
+	}
+	if n.expr != nil {
+		// e.g. a.b and /a/b are the same output key
+		return fmt.Errorf("decode process: %w %s of %s", errDuplicateKey, key, n.key)
+	}
+	n.key, n.expr = key, expr
+	return nil
+}
+
+// setPolicy sets the error policy of a key
+// it returns an error if the key is not in the process spec
+func (proc *process) setPolicy(key string, policy KeyErrorPolicy) error {
+	if !proc.keys[key] {
+		return fmt.Errorf("key %s: not in the process spec", key)
+	}
+	kp := keyPolicy{onError: policy.OnError}
+	switch policy.OnError {
+	case "":
+		kp.onError = OnErrorDefault
+		fallthrough
+	case OnErrorDefault:
+		def, err := Compile(policy.Default)
+		if err != nil {
+			return withKey(err, key)
+		}
+		kp.def = def
+	case OnErrorNull, OnErrorOmit, OnErrorFail:
+	default:
+		return fmt.Errorf("key %s: unknown on_error %s", key, policy.OnError)
+	}
+	proc.policies[key] = kp
+	return nil
+}
+
+// evaluator evaluates a process spec against an input
+type evaluator struct {
+	p        *Parser
+	policy   ErrorPolicy
+	policies map[string]keyPolicy
+	errs     MultiError
+}
+
+// run maps the input into the output document
+// variables are evaluated first in dependency order,
+// a failing variable is nil so VAR returns its default
+// with a collecting error policy, a failing key is omitted
+// and all errors are returned with the partial output
+func (proc *process) run(input map[string]any, policy ErrorPolicy, opts ...ParserOpt) (any, error) {
+	ev := evaluator{
+		p:        NewParser(input, opts...),
+		policy:   policy,
+		policies: proc.policies,
+		errs:     append(MultiError{}, proc.errs...),
+	}
+	for _, v := range proc.vars {
+		val, err := v.expr.eval(ev.p)
+		if err != nil {
+			if val, err = ev.recover(v.name, err); err != nil {
+				return nil, err
+			}
+			if isNoParam(val) {
+				val = nil
+			}
+		}
+		ev.p.vars[v.name] = val
+	}
+	output, err := ev.evalNode(proc.root)
+	if err != nil {
+		return nil, err
+	}
+	if len(ev.errs) > 0 {
+		return output, ev.errs
+	}
+	return output, nil
+}
+
+// recover handles the error of a key with its own error policy
+// it returns the value to write instead, NO_PARAM to omit the key,
+// or the error to stop the evaluation
+func (ev *evaluator) recover(key string, err error) (any, error) {
+	err = withKey(err, key)
+	kp, ok := ev.policies[key]
+	if !ok {
+		return constMap[NoParam], ev.fail(err)
+	}
+	switch kp.onError {
+	case OnErrorNull:
+		return nil, nil
+	case OnErrorOmit:
+		return constMap[NoParam], nil
+	case OnErrorFail:
+		return constMap[NoParam], err
+	default:
+		val, err := kp.def.eval(ev.p)
+		if err != nil {
+			return constMap[NoParam], ev.fail(withKey(err, key))
+		}
+		return val, nil
+	}
+}
+
+// fail handles the error of a key
+// it returns the error to stop the evaluation
+// or nil after collecting it
+func (ev *evaluator) fail(err error) error {
+	if ev.policy == FailFast {
+		return err
+	}
+	ev.errs = append(ev.errs, err)
+	return nil
+}
+
+// evalNode evaluates a node and its children
+// a node with children is written as an object
+// only if its own expression evaluates to true,
+// otherwise the evaluated value is written instead
+// a node with an ARRAY expression is written as an array
+// with its children evaluated once per element
+func (ev *evaluator) evalNode(n *node) (any, error) {
+	if n.expr != nil {
+		val, err := n.expr.eval(ev.p)
+		if err != nil {
+			return ev.recover(n.key, err)
+		}
+		if len(n.children) == 0 || val != true {
+			return val, nil
+		}
+		if src, path, ok := arraySource(n.expr); ok {
+			return ev.evalArray(n, src, path)
+		}
+	}
+	return ev.evalObject(n)
+}
+
+// evalObject evaluates the children of a node into an object
+// a child that evaluates to NO_PARAM is omitted
+func (ev *evaluator) evalObject(n *node) (any, error) {
+	obj := newObject(len(n.children))
+	for _, c := range n.children {
+		val, err := ev.evalNode(c)
+		if err != nil {
+			return nil, err
+		}
+		if isNoParam(val) {
+			continue
+		}
+		obj.set(c.name, val)
+	}
+	return obj, nil
+}
+
+// arraySource returns the source expression
+// of an ARRAY(expr, default) expression
+// and its key parts if it is an input key without a scope marker
+func arraySource(expr *Expr) (exprNode, []pathSegment, bool) {
+	call, ok := expr.root.(*callNode)
+	if !ok || call.fn != Array || len(call.args) == 0 {
+		return nil, nil, false
+	}
+	if key, ok := call.args[0].(*keyNode); ok && key.anchor == anchorScope {
+		return key, key.path, true
+	}
+	return call.args[0], nil, true
+}
+
+// evalArray evaluates the children of a node
+// once per element of the source array
+// input keys inside the source path are looked up
+// from the current element
+func (ev *evaluator) evalArray(n *node, src exprNode, path []pathSegment) (any, error) {
+	p := ev.p
+	val, err := src.eval(p)
+	if err != nil {
+		return ev.recover(n.key, withExpr(err, n.expr.str))
+	}
+	elems, _ := toSlice(val)
+	arr := make([]any, 0, len(elems))
+	for i, elem := range elems {
+		p.scopes = append(p.scopes, scope{path: path, elem: elem, index: i})
+		obj, err := ev.evalObject(n)
+		p.scopes = p.scopes[:len(p.scopes)-1]
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, obj)
+	}
+	return arr, nil
+}
@@ -0,0 +1,89 @@
+package json2json
+
+import (
+	"fmt"
+	"strings"
+)
+
+// variable is a process spec key defined with SET(expr)
+// which is not written to the output
+// but can be read by other keys with VAR('name', default)
+type variable struct {
+	name string
+	expr *Expr
+}
+
+// isSetExpr checks if an expression defines a variable
+func isSetExpr(expr *Expr) bool {
+	call, ok := expr.root.(*callNode)
+	return ok && call.fn == Set
+}
+
+// varRefs returns the variable names referenced in an expression
+// by VAR('name', default)
+func varRefs(expr *Expr) []string {
+	var refs []string
+	walk(expr.root, func(n exprNode) {
+		call, ok := n.(*callNode)
+		if !ok || call.fn != Var || len(call.args) == 0 {
+			return
+		}
+		if lit, ok := call.args[0].(*literalNode); ok {
+			if name, ok := lit.val.(string); ok {
+				refs = append(refs, name)
+			}
+		}
+	})
+	return refs
+}
+
+// sortVars sorts variables so that every variable
+// comes after the variables it references
+// it returns an error if the references form a cycle
+func sortVars(vars []variable) ([]variable, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	byName := make(map[string]variable, len(vars))
+	for _, v := range vars {
+		byName[v.name] = v
+	}
+	state := make(map[string]int, len(vars))
+	sorted := make([]variable, 0, len(vars))
+	var path []string
+	var visit func(v variable) error
+	visit = func(v variable) error {
+		switch state[v.name] {
+		case visited:
+			return nil
+		case visiting:
+			for i, name := range path {
+				if name == v.name {
+					cycle := append(path[i:], v.name)
+					return fmt.Errorf("variable cycle: %s", strings.Join(cycle, " -> "))
+				}
+			}
+		}
+		state[v.name] = visiting
+		path = append(path, v.name)
+		for _, ref := range varRefs(v.expr) {
+			if dep, ok := byName[ref]; ok {
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[v.name] = visited
+		sorted = append(sorted, v)
+		return nil
+	}
+	for _, v := range vars {
+		if err := visit(v); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}